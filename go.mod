@@ -16,6 +16,7 @@ require (
 	github.com/zclconf/go-cty v1.14.4
 	golang.org/x/crypto v0.17.0
 	golang.org/x/sync v0.5.0
+	golang.org/x/sys v0.28.0
 )
 
 require (
@@ -34,7 +35,6 @@ require (
 	github.com/rogpeppe/go-internal v1.12.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/term v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
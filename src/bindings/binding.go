@@ -1,30 +1,62 @@
 package bindings
 
 import (
+	"fmt"
 	"path/filepath"
 
 	"github.com/illikainen/orch/src/hosts"
 	"github.com/illikainen/orch/src/roles"
-	"github.com/illikainen/orch/src/utils"
+	"github.com/illikainen/orch/src/tasks/outputs"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/illikainen/go-utils/src/seq"
 	"github.com/zclconf/go-cty/cty"
 )
 
+var schema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "vars"},
+	},
+}
+
 type Binding struct {
 	Name         string   `hcl:"name,label"`
 	Hosts        []string `hcl:"hosts,optional"`
 	Tags         []string `hcl:"tags,optional"`
 	RoleDirs     []string `hcl:"roles,optional"`
+	Body         hcl.Body `hcl:"body,remain"`
 	Roles        roles.Roles
 	Dependencies []string
+	References   []*outputs.Reference
 	value        cty.Value
+	varNames     []string
+	staticVars   bool
 }
 
-func (b *Binding) PartialDecode(basedir string) error {
+func (b *Binding) PartialDecode(path *roles.Path) error {
+	content, diags := b.Body.Content(schema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// The names of the vars are needed to tell which roles they're passed
+	// to before anything is evaluated.  They're only known if the vars are
+	// an object with literal keys.
+	b.staticVars = true
+	if attr, ok := content.Attributes["vars"]; ok {
+		b.varNames, b.staticVars = staticKeys(attr.Expr)
+
+		for _, ref := range outputs.References(attr.Expr) {
+			b.References = append(b.References, ref)
+			if ref.Host != "this" {
+				b.Dependencies = append(b.Dependencies, ref.Host)
+			}
+		}
+	}
+
 	for _, roledir := range b.RoleDirs {
-		dir, err := utils.JoinCtyPath(basedir, roledir)
+		dir, err := path.Lookup(roledir)
 		if err != nil {
 			return err
 		}
@@ -35,21 +67,112 @@ func (b *Binding) PartialDecode(basedir string) error {
 		})
 	}
 
-	if err := b.Roles.PartialDecode(); err != nil {
+	if err := b.Roles.PartialDecode(path); err != nil {
 		return err
 	}
 
 	for _, role := range b.Roles {
-		b.Dependencies = role.Dependencies
+		b.Dependencies = append(b.Dependencies, role.Dependencies...)
 	}
 
 	return nil
 }
 
-func (b *Binding) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
+// Decode passes the `vars' of the binding to each of its roles.  Every var
+// must be declared in the defaults of at least one role to catch typos.
+func (b *Binding) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
+	ctx, err := ctxfn(b.Body)
+	if err != nil {
+		return err
+	}
+
+	content, diags := b.Body.Content(schema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	vars := map[string]cty.Value{}
+	rng := b.Body.MissingItemRange()
+	if attr, ok := content.Attributes["vars"]; ok {
+		rng = attr.Expr.Range()
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		if value.IsNull() || !value.CanIterateElements() ||
+			!(value.Type().IsObjectType() || value.Type().IsMapType()) {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid vars",
+				Detail:   fmt.Sprintf("The vars of \"%s\" must be an object.", b.Name),
+				Subject:  attr.Expr.Range().Ptr(),
+			}}
+		}
+		value, marks := value.Unmark()
+		for name, elt := range value.AsValueMap() {
+			vars[name] = elt.WithMarks(marks)
+		}
+
+		for name := range vars {
+			if !seq.ContainsBy(b.Roles, func(r *roles.Role) bool { return r.HasDefault(name) }) {
+				return hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Undeclared role variable",
+					Detail: fmt.Sprintf("No role in \"%s\" declares a default for \"%s\".",
+						b.Name, name),
+					Subject: attr.Expr.Range().Ptr(),
+				}}
+			}
+		}
+	}
+
+	for _, role := range b.Roles {
+		role.Vars = vars
+		role.VarsRange = rng
+	}
+
 	return b.Roles.Decode(ctxfn)
 }
 
+// DecodeReferences returns the references in the vars of the binding and in
+// the defaults and variables of its roles.  They're evaluated when the
+// binding is decoded, before any task of its roles.
+func (b *Binding) DecodeReferences() []*outputs.Reference {
+	refs := append([]*outputs.Reference{}, b.References...)
+	for _, role := range b.Roles {
+		refs = append(refs, role.References...)
+	}
+	return refs
+}
+
+// PassesVars checks whether the binding may pass any of its vars to a role.
+// Vars that aren't known until they're evaluated may be passed to any role
+// with defaults.
+func (b *Binding) PassesVars(role *roles.Role) bool {
+	if !b.staticVars {
+		return role.HasDefaults()
+	}
+	return seq.ContainsBy(b.varNames, role.HasDefault)
+}
+
+func staticKeys(expr hcl.Expression) ([]string, bool) {
+	obj, ok := expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, false
+	}
+
+	names := []string{}
+	for _, item := range obj.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || !key.Type().Equals(cty.String) || !key.IsKnown() || key.IsNull() {
+			return nil, false
+		}
+		names = append(names, key.AsString())
+	}
+	return names, true
+}
+
 func (b *Binding) Match(host *hosts.Host) bool {
 	if seq.Contains(b.Hosts, host.Name) {
 		return true
@@ -1,6 +1,10 @@
 package bindings
 
 import (
+	"github.com/illikainen/orch/src/hosts"
+	"github.com/illikainen/orch/src/roles"
+
+	"github.com/hashicorp/hcl/v2"
 	"github.com/illikainen/go-utils/src/seq"
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
@@ -8,16 +12,80 @@ import (
 
 type Bindings []*Binding
 
-func (b *Bindings) PartialDecode(basedir string) error {
+// PartialDecode decodes the roles of every binding.  Errors are collected as
+// diagnostics so that every binding is checked, and errors that aren't
+// diagnostics are reported at the binding.
+func (b *Bindings) PartialDecode(path *roles.Path) error {
+	var diags hcl.Diagnostics
 	for _, binding := range *b {
-		err := binding.PartialDecode(basedir)
-		if err != nil {
-			return err
+		err := binding.PartialDecode(path)
+		if err == nil {
+			continue
 		}
+
+		if d, ok := err.(hcl.Diagnostics); ok {
+			diags = append(diags, d...)
+		} else {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  err.Error(),
+				Subject:  binding.Body.MissingItemRange().Ptr(),
+			})
+		}
+	}
+
+	if diags.HasErrors() {
+		return diags
 	}
 	return b.Validate()
 }
 
+// Bound is a role that is bound to a host through a binding.
+type Bound struct {
+	Binding *Binding
+	Role    *roles.Role
+}
+
+// Match returns the roles that are bound to a host in the order that they're
+// applied.  Roles that are bound through several bindings, such as a
+// dependency that is shared by roles in different bindings, are only applied
+// once, with the first binding that binds them.  It's therefore an error if
+// any of those bindings passes vars to the role, since the vars of the other
+// bindings would be ignored.  It's also an error if different roles with the
+// same name are bound to a host since their outputs would be
+// indistinguishable.
+func (b *Bindings) Match(host *hosts.Host) ([]*Bound, error) {
+	bound := []*Bound{}
+	for _, binding := range *b {
+		if !binding.Match(host) {
+			continue
+		}
+
+		for _, role := range binding.Roles {
+			prev, ok := seq.FindBy(bound, func(e *Bound) bool { return e.Role.Name == role.Name })
+			if !ok {
+				bound = append(bound, &Bound{Binding: binding, Role: role})
+				continue
+			}
+
+			if prev.Role.Dir != role.Dir {
+				return nil, errors.Errorf("%s: \"%s\" in \"%s\" and \"%s\" in \"%s\" are different roles "+
+					"with the same name", host.Name, prev.Role.Dir, prev.Binding.Name, role.Dir, binding.Name)
+			}
+
+			for _, elt := range []*Bound{prev, {Binding: binding, Role: role}} {
+				if elt.Binding.PassesVars(elt.Role) {
+					return nil, errors.Errorf("%s: \"%s\" is bound by both \"%s\" and \"%s\" and is only "+
+						"applied once, so \"%s\" can't pass vars to it", host.Name, role.Name,
+						prev.Binding.Name, binding.Name, elt.Binding.Name)
+				}
+			}
+		}
+	}
+
+	return bound, nil
+}
+
 func (b *Bindings) Variables() map[string]cty.Value {
 	roles := map[string]cty.Value{}
 	bindings := map[string]cty.Value{}
@@ -5,165 +5,245 @@ import (
 	"encoding/json"
 	"io"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
 
 	"github.com/illikainen/orch/src/hosts/qvm"
+	"github.com/illikainen/orch/src/roles"
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/state"
 	"github.com/illikainen/orch/src/tasks/outputs"
+	"github.com/illikainen/orch/src/utils"
 
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/illikainen/go-netutils/src/sshx"
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/illikainen/go-utils/src/seq"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
 	"golang.org/x/sync/errgroup"
 )
 
 func Apply(opts *Options) error {
-	output := outputs.Outputs{}
+	var run *state.Run
 
-	// Apply local changes first in case localhost needs to be hardened before
-	// communicating with remotes.
-	if !sandbox.IsSandboxed() {
-		var err error
-		output, err = applyLocal(opts)
+	if opts.CachedFacts && (!opts.DryRun || opts.RefreshFacts) {
+		return errors.Errorf("--cached-facts requires --dry-run and can't be combined with --refresh-facts")
+	}
+
+	// The sandboxed subprocess is started in a new session without a
+	// controlling terminal, so it's unable to prompt for --step.
+	if opts.Step && sandbox.Compatible() && !sandbox.IsSandboxed() {
+		if _, ok := opts.Sandbox.(*sandbox.Noop); !ok {
+			return errors.Errorf("--step requires --sandbox none")
+		}
+	}
+
+	if sandbox.IsSandboxed() {
+		// The run, including the output from non-sandboxed local applies,
+		// is sent as JSON on stdin to sandboxed subprocesses.
+		data := bytes.Buffer{}
+		_, err := io.Copy(&data, os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(data.Bytes(), &run)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Role sources are fetched once, before the blueprint is decoded
+		// by the sandboxed subprocess and by the goroutine of each host.
+		err := Fetch(opts)
+		if err != nil {
+			return err
+		}
+
+		run, err = newRun(opts)
 		if err != nil {
 			return err
 		}
+
+		// Apply local changes first in case localhost needs to be hardened
+		// before communicating with remotes.
+		err = applyLocal(run, opts)
+		if err != nil {
+			return recordRun(run, opts, err)
+		}
 	}
 
 	// Re-execute ourselves in a sandbox on compatible systems before applying
-	// on the remotes.
+	// on the remotes.  Note that a successfully confined subprocess never
+	// returns, so we only proceed if the sandbox is a no-op.
 	if sandbox.Compatible() && !sandbox.IsSandboxed() {
-		return startSandbox(output, opts)
+		err := startSandbox(opts, run)
+		if err != nil {
+			// The sandboxed subprocess records the run by itself unless
+			// it failed before getting that far.
+			if opts.Config != nil && opts.Config.StateDir != "" {
+				if _, e := state.NewStore(opts.Config.StateDir).Read(run.ID); e == nil {
+					return err
+				}
+			}
+			return recordRun(run, opts, err)
+		}
 	}
 
-	return applyRemote(output, opts)
+	return recordRun(run, opts, applyRemote(run, opts))
 }
 
-func applyLocal(opts *Options) (outputs.Outputs, error) {
+func newRun(opts *Options) (*state.Run, error) {
 	blueprint := NewBlueprint(opts)
 	if err := blueprint.PartialDecode(); err != nil {
 		return nil, err
 	}
 
-	output := outputs.Outputs{}
+	path, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := state.NewRun(path, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	run.Hash, err = blueprint.Hash()
+	if err != nil {
+		return nil, err
+	}
+
 	for _, host := range blueprint.Hosts {
-		if host.Type == "local" {
-			out, err := blueprint.Apply(host.Name, output)
-			if err != nil {
-				return nil, err
-			}
-			output = append(output, out...)
-		}
+		run.Hosts = append(run.Hosts, host.Name)
 	}
 
-	return output, nil
+	log.Debugf("run %s: blueprint %s (sha256=%s)", run.ID, run.Blueprint, run.Hash)
+	return run, nil
 }
 
-type worker struct {
-	name   string
-	output outputs.Outputs
-	err    error
+// The run is recorded in the state directory regardless of whether the apply
+// succeeded so that failed runs show up in the history.
+func recordRun(run *state.Run, opts *Options, err error) error {
+	if opts.Config == nil || opts.Config.StateDir == "" {
+		return err
+	}
+
+	run.Finish(err)
+	return errorx.Join(err, state.NewStore(opts.Config.StateDir).Write(run))
 }
 
-func applyRemote(output outputs.Outputs, opts *Options) error {
-	// The output from non-sandboxed local applies is sent as JSON on stdin
-	// to sandboxed subprocesses.
-	if sandbox.IsSandboxed() {
-		data := bytes.Buffer{}
-		_, err := io.Copy(&data, os.Stdin)
-		if err != nil {
-			return err
-		}
+func applyLocal(run *state.Run, opts *Options) error {
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		return err
+	}
 
-		err = json.Unmarshal(data.Bytes(), &output)
-		if err != nil {
-			return err
+	for _, host := range blueprint.Hosts {
+		if host.Type == "local" {
+			out, err := blueprint.Apply(host.Name, run.Outputs)
+			run.Outputs = append(run.Outputs, out...)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	return nil
+}
+
+// Remote hosts are applied in parallel.  Tasks wait for the outputs that
+// they refer to on other hosts through a shared schedule.
+func applyRemote(run *state.Run, opts *Options) error {
 	blueprint := NewBlueprint(opts)
 	if err := blueprint.PartialDecode(); err != nil {
 		return err
 	}
 
-	channels := make([]chan worker, len(blueprint.Hosts))
-	for i := range blueprint.Hosts {
-		channels[i] = make(chan worker, len(blueprint.Hosts))
-	}
-
-	deps := blueprint.Dependencies.Filter(output.Hosts())
-	if circular, host := deps.FindCircularDependencies(); circular {
-		return errors.Errorf("circular dependency in %s", host)
-	}
+	sched := newSchedule(blueprint, run.Outputs)
+	output := append(outputs.Outputs{}, run.Outputs...)
 
+	mutex := sync.Mutex{}
 	group := errgroup.Group{}
-	for i, host := range blueprint.Hosts {
+	for _, host := range blueprint.Hosts {
 		if host.Type == "local" {
 			continue
 		}
 
-		idx := i
 		name := host.Name
-		out, err := output.Clone()
-		if err != nil {
-			return err
-		}
-
 		group.Go(func() error {
 			bp := NewBlueprint(opts)
 			if err := bp.PartialDecode(); err != nil {
-				for _, c := range channels {
-					c <- worker{name: name, err: err}
-				}
+				sched.finish(name, err)
 				return err
 			}
+			bp.schedule = sched
 
-			for len(deps[name]) != 0 {
-				log.Infof("%s: waiting for %s...", name, strings.Join(deps[name], ", "))
+			newOut, err := bp.Apply(name, output)
 
-				done := <-channels[idx]
-				deps = deps.Filter([]string{done.name})
-
-				if done.err != nil {
-					for _, c := range channels {
-						c <- worker{name: name, err: done.err}
-					}
-					return done.err
-				}
-
-				out = append(out, done.output...)
-			}
+			mutex.Lock()
+			run.Outputs = append(run.Outputs, newOut...)
+			mutex.Unlock()
 
-			newOut, err := bp.Apply(name, out)
-			if err != nil {
-				for _, c := range channels {
-					c <- worker{name: name, err: err}
-				}
-				return err
-			}
-
-			for _, c := range channels {
-				c <- worker{name: name, output: newOut, err: nil}
-			}
-			return nil
+			sched.finish(name, err)
+			return err
 		})
 	}
 
 	return group.Wait()
 }
 
-func startSandbox(output outputs.Outputs, opts *Options) error {
+// The stdin value is sent as JSON to the sandboxed subprocess.
+func startSandbox(opts *Options, stdin any) error {
 	blueprint := NewBlueprint(opts)
 	if err := blueprint.PartialDecode(); err != nil {
 		return err
 	}
 
-	ro := []string{opts.Path}
+	ro := append([]string{}, opts.VarFiles...)
 	rw := []string{}
 	dev := []string{}
 
+	// Blueprints and includes that are directories are shared as a whole.
+	// Single files are shared by themselves, along with the files that they
+	// read with literal paths in file() and similar functions.
+	srcs := []string{opts.Path}
 	for _, include := range blueprint.Includes {
-		ro = append(ro, include.Src)
+		srcs = append(srcs, include.Src)
+	}
+
+	for _, src := range srcs {
+		stat, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+
+		if stat.IsDir() {
+			ro = append(ro, src)
+			continue
+		}
+
+		paths, err := blueprint.filePaths(src)
+		if err != nil {
+			return err
+		}
+		ro = append(ro, src)
+
+		for _, path := range paths {
+			for _, p := range []string{path, path + ".seal"} {
+				ok, err := iofs.Exists(p)
+				if err != nil {
+					return err
+				}
+				if ok {
+					ro = append(ro, p)
+				}
+			}
+		}
 	}
 
 	for _, binding := range blueprint.Bindings {
@@ -172,6 +252,21 @@ func startSandbox(output outputs.Outputs, opts *Options) error {
 		}
 	}
 
+	// Role sources are resolved again in the sandboxed subprocess, which
+	// needs the lock file and the sources to verify their hashes.
+	for _, dir := range blueprint.rolePath.Sources {
+		ro = append(ro, dir)
+	}
+
+	lock := roles.LockPath(opts.Path)
+	ok, err := iofs.Exists(lock)
+	if err != nil {
+		return err
+	}
+	if ok {
+		ro = append(ro, lock)
+	}
+
 	sshRO, sshRW, err := sshx.SandboxPaths()
 	if err != nil {
 		return err
@@ -183,6 +278,17 @@ func startSandbox(output outputs.Outputs, opts *Options) error {
 	if err != nil {
 		return err
 	}
+	if opts.Config != nil && opts.Config.StateDir != "" {
+		// The state directory is created before it's shared with the
+		// sandbox because non-existing read-write paths are replaced by
+		// their closest existing parent.
+		err := os.MkdirAll(opts.Config.StateDir, 0700)
+		if err != nil {
+			return err
+		}
+		rw = append(rw, opts.Config.StateDir)
+	}
+
 	ro = append(ro, qvmRO...)
 	rw = append(rw, qvmRW...)
 	dev = append(dev, qvmDev...)
@@ -202,7 +308,7 @@ func startSandbox(output outputs.Outputs, opts *Options) error {
 		return err
 	}
 
-	data, err := json.Marshal(&output)
+	data, err := json.Marshal(stdin)
 	if err != nil {
 		return err
 	}
@@ -212,3 +318,56 @@ func startSandbox(output outputs.Outputs, opts *Options) error {
 
 	return opts.Sandbox.Confine()
 }
+
+// filePaths returns the paths that an HCL file reads with file(),
+// filebase64(), fileset(), secret() and templatefile().  Paths that aren't
+// literals are unknown until the file is evaluated, so they aren't available
+// in the sandbox.
+func (b *Blueprint) filePaths(src string) ([]string, error) {
+	data, _, err := seal.ReadSource(src, b.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(data, src, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, errors.Errorf("invalid body type")
+	}
+
+	paths := []string{}
+	diags = hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+		call, ok := node.(*hclsyntax.FunctionCallExpr)
+		if !ok || len(call.Args) == 0 || !seq.Contains(fileFunctionNames, call.Name) {
+			return nil
+		}
+
+		value, diags := call.Args[0].Value(nil)
+		if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+			log.Warnf("%s: %s() with a non-literal path is unavailable in the sandbox",
+				call.Args[0].Range(), call.Name)
+			return nil
+		}
+
+		path, err := utils.JoinCtyPath(body, value.AsString())
+		if err != nil {
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  err.Error(),
+				Subject:  call.Args[0].Range().Ptr(),
+			}}
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return paths, nil
+}
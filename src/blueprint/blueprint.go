@@ -1,9 +1,8 @@
 package blueprint
 
 import (
-	"bytes"
 	"encoding/json"
-	"io"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -14,8 +13,12 @@ import (
 	"github.com/illikainen/orch/src/fact"
 	"github.com/illikainen/orch/src/hosts"
 	"github.com/illikainen/orch/src/includes"
-	"github.com/illikainen/orch/src/metadata"
+	"github.com/illikainen/orch/src/roles"
 	"github.com/illikainen/orch/src/rpc"
+	"github.com/illikainen/orch/src/rpc/controller"
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/state"
+	"github.com/illikainen/orch/src/tasks"
 	"github.com/illikainen/orch/src/tasks/outputs"
 	"github.com/illikainen/orch/src/utils"
 	"github.com/illikainen/orch/src/variables"
@@ -23,9 +26,9 @@ import (
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
 	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/illikainen/go-cryptor/src/blob"
 	"github.com/illikainen/go-utils/src/assoc"
-	"github.com/illikainen/go-utils/src/base64"
 	"github.com/illikainen/go-utils/src/errorx"
 	"github.com/illikainen/go-utils/src/fn"
 	"github.com/illikainen/go-utils/src/sandbox"
@@ -37,8 +40,21 @@ import (
 )
 
 type Filter struct {
-	Hosts []string
-	Tags  []string
+	Hosts    []string
+	Tags     []string
+	TaskTags []string
+	SkipTags []string
+}
+
+// MatchTask checks whether a task with the given tags should be applied.  A
+// task is skipped if it has any of the skipped tags, or if task tags are
+// requested and it has none of them.
+func (f *Filter) MatchTask(tags []string) bool {
+	if len(seq.Intersect(f.SkipTags, tags)) > 0 {
+		return false
+	}
+
+	return len(f.TaskTags) == 0 || len(seq.Intersect(f.TaskTags, tags)) > 0
 }
 
 type Options struct {
@@ -48,6 +64,12 @@ type Options struct {
 	Sandbox      sandbox.Sandbox
 	DryRun       bool
 	AllowMissing bool
+	RefreshFacts bool
+	CachedFacts  bool
+	StartAtTask  string
+	Step         bool
+	Vars         []string
+	VarFiles     []string
 }
 
 type Blueprint struct {
@@ -57,49 +79,47 @@ type Blueprint struct {
 	Hosts        hosts.Hosts         `hcl:"host,block"`
 	Bindings     bindings.Bindings   `hcl:"bind,block"`
 	Dependencies Dependencies
+	rolePath     *roles.Path
+	bound        map[string][]*bindings.Bound
 	facts        *fact.Facts
 	output       outputs.Outputs
+	schedule     *schedule
 	functions    map[string]function.Function
 	opts         *Options
 }
 
 func NewBlueprint(opts *Options) *Blueprint {
-	return &Blueprint{
-		Config:       fn.Ternary(opts.Config != nil, opts.Config, &configs.Config{}),
+	// Every blueprint decodes into its own copy of the config since the
+	// blueprints of each host are decoded concurrently.
+	config := &configs.Config{}
+	if opts.Config != nil {
+		c := *opts.Config
+		config = &c
+	}
+
+	b := &Blueprint{
+		Config:       config,
 		Dependencies: map[string][]string{},
+		bound:        map[string][]*bindings.Bound{},
 		functions:    localFunctions(),
 		opts:         opts,
 	}
+	b.functions["local_exec"] = b.localExec()
+	return b
 }
 
 func (b *Blueprint) PartialDecode() error {
-	err := b.partialDecodeMerge(b.opts.Path)
-	if err != nil {
-		return err
-	}
-
-	err = b.Includes.PartialDecode(filepath.Dir(b.opts.Path))
+	err := b.partialDecodeConfig()
 	if err != nil {
 		return err
 	}
 
-	for _, include := range b.Includes {
-		err := b.partialDecodeMerge(include.Src)
-		if err != nil {
-			return err
-		}
-	}
-
-	if b.opts.DryRun {
-		b.Config.DryRun = b.opts.DryRun
-	}
-
-	err = b.Config.PartialDecode()
+	err = b.Variables.PartialDecode()
 	if err != nil {
 		return err
 	}
 
-	err = b.Variables.PartialDecode()
+	err = b.overrideVariables()
 	if err != nil {
 		return err
 	}
@@ -112,12 +132,30 @@ func (b *Blueprint) PartialDecode() error {
 		return err
 	}
 
-	err = b.Bindings.PartialDecode(filepath.Dir(b.opts.Path))
+	b.rolePath, err = b.resolveRolePath()
 	if err != nil {
 		return err
 	}
 
+	// Errors in the bindings and the dependencies between hosts are
+	// collected so that every problem is reported at once.
+	var diags hcl.Diagnostics
+	err = b.Bindings.PartialDecode(b.rolePath)
+	if err != nil {
+		diags = appendDiagnostics(diags, err, nil)
+	}
+
+	if b.opts.StartAtTask != "" && !b.hasTask(b.opts.StartAtTask) {
+		diags = appendDiagnostics(diags, errors.Errorf("--start-at-task: %s is not a task in any bound role",
+			b.opts.StartAtTask), nil)
+	}
+
 	for _, host := range b.Hosts {
+		b.bound[host.Name], err = b.Bindings.Match(host)
+		if err != nil {
+			diags = appendDiagnostics(diags, err, host.Body.MissingItemRange().Ptr())
+		}
+
 		deps := host.Dependencies
 		for _, binding := range b.Bindings {
 			if binding.Match(host) {
@@ -127,21 +165,198 @@ func (b *Blueprint) PartialDecode() error {
 		deps = seq.Uniq(seq.Filter(deps, host.Name))
 
 		for _, dep := range deps {
-			if !seq.ContainsBy(b.Hosts, func(h *hosts.Host) bool {
+			other, ok := seq.FindBy(b.Hosts, func(h *hosts.Host) bool {
 				return h.Name == dep
-			}) {
-				return errors.Errorf("%s depends on %s but %s is not scheduled to be applied",
-					host.Name, dep, dep)
+			})
+			if !ok {
+				diags = append(diags, b.unscheduledDiagnostics(host, dep)...)
+			} else if host.Type == "local" && !b.appliedBefore(other, host) {
+				diags = append(diags, b.localOrderDiagnostics(host, dep)...)
 			}
 		}
 
 		b.Dependencies[host.Name] = deps
 	}
 
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Hosts may depend on each other as long as their tasks don't.
+	deps, reasons := b.taskDependencies()
+	if cycle := deps.FindCircularDependencies(); cycle != nil {
+		return b.circularDependencyError(cycle, reasons)
+	}
+
 	return nil
 }
 
-func (b *Blueprint) partialDecodeMerge(path string) (err error) {
+// unscheduledDiagnostics reports every reference that makes a host depend on
+// a host that isn't scheduled to be applied.
+func (b *Blueprint) unscheduledDiagnostics(host *hosts.Host, dep string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, reason := range b.dependencyReasons(host, dep) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to unscheduled host",
+			Detail: fmt.Sprintf("%s depends on %s through %s in %s, but %s is not scheduled to be applied.",
+				host.Name, dep, reason.ref, reason.where, dep),
+			Subject: reason.ref.Range.Ptr(),
+		})
+	}
+
+	// The dependency may come from a role variable rather than from a host
+	// or a task.
+	if len(diags) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to unscheduled host",
+			Detail:   fmt.Sprintf("%s depends on %s but %s is not scheduled to be applied.", host.Name, dep, dep),
+			Subject:  host.Body.MissingItemRange().Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// Local hosts are applied one at a time, in order, before any remote host.
+func (b *Blueprint) appliedBefore(dep *hosts.Host, host *hosts.Host) bool {
+	if dep.Type != "local" {
+		return false
+	}
+
+	for _, elt := range b.Hosts {
+		if elt == dep {
+			return true
+		}
+		if elt == host {
+			return false
+		}
+	}
+	return false
+}
+
+// localOrderDiagnostics reports every reference that makes a local host
+// depend on a host that isn't applied before it.
+func (b *Blueprint) localOrderDiagnostics(host *hosts.Host, dep string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, reason := range b.dependencyReasons(host, dep) {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to a host that is applied later",
+			Detail: fmt.Sprintf("%s depends on %s through %s in %s, but local hosts are applied "+
+				"in order before any remote host, so %s is not applied before %s.",
+				host.Name, dep, reason.ref, reason.where, dep, host.Name),
+			Subject: reason.ref.Range.Ptr(),
+		})
+	}
+
+	if len(diags) == 0 {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Reference to a host that is applied later",
+			Detail: fmt.Sprintf("%s depends on %s, but local hosts are applied in order before "+
+				"any remote host, so %s is not applied before %s.", host.Name, dep, dep, host.Name),
+			Subject: host.Body.MissingItemRange().Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// partialDecodeConfig merges the blueprint and its includes, and decodes the
+// parts of the config that are needed before anything is evaluated.
+func (b *Blueprint) partialDecodeConfig() error {
+	err := b.partialDecodeMerge(b.opts.Path)
+	if err != nil {
+		return err
+	}
+
+	err = b.Includes.PartialDecode(filepath.Dir(b.opts.Path))
+	if err != nil {
+		return err
+	}
+
+	for _, include := range b.Includes {
+		err := b.partialDecodeMerge(include.Src)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.opts.DryRun {
+		b.Config.DryRun = b.opts.DryRun
+	}
+
+	return b.Config.PartialDecode()
+}
+
+// resolveRolePath resolves the role path and the role sources of the config.
+// Role sources are resolved from the lock file of the blueprint without
+// fetching anything, and only if there's anything to bind so that the
+// configuration file isn't expected to have a lock file of its own.
+func (b *Blueprint) resolveRolePath() (*roles.Path, error) {
+	dirs, err := b.Config.RoleSearchPath()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	if len(b.Bindings) > 0 {
+		srcs, err := b.Config.ResolveRoleSources()
+		if err != nil {
+			return nil, err
+		}
+
+		sources, err = roles.ResolveSources(srcs, roles.LockPath(b.opts.Path))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &roles.Path{
+		Basedir: filepath.Dir(b.opts.Path),
+		Dirs:    dirs,
+		Sources: sources,
+		Config:  b.Config,
+	}, nil
+}
+
+// Fetch checks out the role sources of a blueprint and updates its lock file.
+// It's the only place where role sources are fetched, so that decoding a
+// blueprint never touches the network.
+func Fetch(opts *Options) error {
+	blueprint := NewBlueprint(opts)
+	err := blueprint.partialDecodeConfig()
+	if err != nil {
+		return err
+	}
+
+	sources, err := blueprint.Config.ResolveRoleSources()
+	if err != nil {
+		return err
+	}
+
+	return roles.FetchSources(sources, roles.LockPath(opts.Path))
+}
+
+// hasTask checks whether a task, given as `role.task', is in any bound role.
+func (b *Blueprint) hasTask(name string) bool {
+	for _, binding := range b.Bindings {
+		for _, role := range binding.Roles {
+			for _, task := range role.Tasks {
+				if role.Name+"."+task.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (b *Blueprint) partialDecodeMerge(path string) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		if b.opts.AllowMissing && os.IsNotExist(err) {
@@ -172,100 +387,257 @@ func (b *Blueprint) partialDecodeMerge(path string) (err error) {
 	}
 
 	log.Debugf("decoding %s", path)
-	input, err := os.Open(path) // #nosec G304
+	data, _, err := seal.ReadSource(path, b.Config)
 	if err != nil {
 		return err
 	}
-	defer errorx.Defer(input.Close, &err)
 
-	var data []byte
-	if strings.ToLower(filepath.Ext(path)) == ".hclseal" {
-		keys, err := blob.ReadKeyring(b.Config.PrivateKey, b.Config.PublicKeys)
+	hcl := hclparse.NewParser()
+	hclFile, diags := hcl.ParseHCL(data, path)
+	if diags != nil {
+		return diags
+	}
+
+	tmp := &Blueprint{}
+	diags = gohcl.DecodeBody(hclFile.Body, nil, tmp)
+	if diags != nil {
+		return diags
+	}
+
+	b.Includes = append(b.Includes, tmp.Includes...)
+	b.Config = fn.Ternary(tmp.Config != nil, tmp.Config, b.Config)
+	b.Variables = append(b.Variables, tmp.Variables...)
+	b.Hosts = append(b.Hosts, tmp.Hosts...)
+	b.Bindings = append(b.Bindings, tmp.Bindings...)
+	return nil
+}
+
+// Variables declared in the blueprint are overridden by var files in the
+// order they're given, and then by individual --var arguments.  The last
+// value wins.
+func (b *Blueprint) overrideVariables() error {
+	for _, path := range b.opts.VarFiles {
+		data, sealed, err := seal.ReadSource(path, b.Config)
 		if err != nil {
 			return err
 		}
 
-		decoder, err := base64.NewDecoder(base64.StdEncoding.Strict(), input)
+		values, err := variables.ParseOverrideFile(seal.UnsealedName(path), data)
 		if err != nil {
 			return err
 		}
 
-		blobber, err := blob.NewReader(decoder, &blob.Options{
-			Type:      metadata.Name(),
-			Keyring:   keys,
-			Encrypted: true,
-		})
+		if sealed {
+			for name, value := range values {
+				values[name] = utils.MarkSensitive(value)
+			}
+		}
+
+		err = b.Variables.Override(values)
 		if err != nil {
-			return err
+			return errors.Wrap(err, path)
 		}
+	}
 
-		buf := &bytes.Buffer{}
-		_, err = io.Copy(buf, blobber)
+	for _, arg := range b.opts.Vars {
+		name, value, err := variables.ParseOverride(arg)
 		if err != nil {
 			return err
 		}
 
-		data = buf.Bytes()
-	} else {
-		buf := &bytes.Buffer{}
-		_, err := io.Copy(buf, input)
+		err = b.Variables.Override(map[string]cty.Value{name: value})
 		if err != nil {
 			return err
 		}
-
-		data = buf.Bytes()
-	}
-
-	hcl := hclparse.NewParser()
-	hclFile, diags := hcl.ParseHCL(data, path)
-	if diags != nil {
-		return diags
 	}
 
-	tmp := &Blueprint{}
-	diags = gohcl.DecodeBody(hclFile.Body, nil, tmp)
-	if diags != nil {
-		return diags
-	}
-
-	b.Includes = append(b.Includes, tmp.Includes...)
-	b.Config = fn.Ternary(tmp.Config != nil, tmp.Config, b.Config)
-	b.Variables = append(b.Variables, tmp.Variables...)
-	b.Hosts = append(b.Hosts, tmp.Hosts...)
-	b.Bindings = append(b.Bindings, tmp.Bindings...)
 	return nil
 }
 
 func (b *Blueprint) Apply(name string, o outputs.Outputs) (output outputs.Outputs, err error) {
 	b.output = o
 
-	err = b.Includes.Decode(b.evalContext)
+	if host, ok := seq.FindBy(b.Hosts, func(h *hosts.Host) bool { return h.Name == name }); ok {
+		err := b.await(name, host.References)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	host, err := b.decodeHost(name)
 	if err != nil {
 		return nil, err
 	}
 
-	err = b.Config.Decode(b.evalContext)
+	err = host.Connector.Dial()
+	if err != nil {
+		return nil, err
+	}
+	defer errorx.Defer(host.Connector.Close, &err)
+
+	err = host.Connector.UploadBinary()
 	if err != nil {
 		return nil, err
 	}
 
-	err = b.Variables.Decode(b.evalContext)
+	ctrl, err := host.Connector.Start()
 	if err != nil {
 		return nil, err
 	}
+	defer errorx.Defer(ctrl.Close, &err)
 
-	host, ok := seq.FindBy(b.Hosts, func(h *hosts.Host) bool {
-		return h.Name == name
-	})
-	if !ok {
-		return nil, errors.Errorf("invalid host: %s", name)
+	b.facts, err = b.loadFacts(host.Name, ctrl)
+	if err != nil {
+		return nil, err
 	}
 
-	err = host.Decode(b.evalContext)
+	b.functions = assoc.Merge(b.functions, host.Connector.Functions())
+
+	// Tasks before --start-at-task are decoded but not applied so that
+	// they're handled the same way as skipped tasks by later references.
+	started := b.opts.StartAtTask == ""
+
+	// Bindings are decoded before their first role is applied so that their
+	// vars may refer to the outputs of earlier bindings.
+	decoded := map[string]bool{}
+	for _, bound := range b.bound[host.Name] {
+		binding, role := bound.Binding, bound.Role
+		if !decoded[binding.Name] {
+			err := b.await(host.Name, binding.DecodeReferences())
+			if err != nil {
+				return output, err
+			}
+
+			err = binding.Decode(b.evalContext)
+			if err != nil {
+				return nil, err
+			}
+			decoded[binding.Name] = true
+		}
+
+		for _, task := range role.Tasks {
+			if !b.opts.Filter.MatchTask(role.TaskTags(task)) {
+				output = append(output, b.skipTask(host.Name, role.Name, task))
+				continue
+			}
+
+			err := b.await(host.Name, task.References)
+			if err != nil {
+				return output, err
+			}
+
+			err = task.Decode(role.Name, host.Name, role.EvalContext(b.evalContext), b.Config)
+			if err != nil {
+				return nil, err
+			}
+
+			if !started {
+				if b.opts.StartAtTask != role.Name+"."+task.Name {
+					output = append(output, b.skipTask(host.Name, role.Name, task))
+					continue
+				}
+				started = true
+			}
+
+			if !task.Include() {
+				b.settle(host.Name, role.Name, task.Name, nil)
+				continue
+			}
+
+			if b.opts.Step {
+				ok, err := confirmTask(host.Name, role.Name, task.Name)
+				if err != nil {
+					return output, err
+				}
+
+				if !ok {
+					output = append(output, b.skipTask(host.Name, role.Name, task))
+					continue
+				}
+			}
+
+			out, err := task.Apply(ctrl)
+			if err != nil {
+				return output, errors.Errorf("%s: %s.%s: %s", host.Name, role.Name, task.Name, err)
+			}
+
+			b.settle(host.Name, role.Name, task.Name, out)
+			output = append(output, out)
+
+			log.Infof("%s: %s.%s: %s", host.Name, role.Name, task.Name, out.Status())
+			for typ, diffs := range out.Differences() {
+				if len(diffs) > 0 {
+					log.Infof("    %s\n    %s\n", typ, strings.Repeat("-", len(typ)))
+
+					for _, diff := range diffs {
+						log.Infof("    %s", diff)
+					}
+					log.Info()
+				}
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// Skipped tasks have an output without changes so that references to them
+// can be evaluated.
+func (b *Blueprint) skipTask(host string, role string, task *tasks.Task) *outputs.Output {
+	out := &outputs.Output{
+		Type:    task.Type,
+		Host:    host,
+		Role:    role,
+		Name:    task.Name,
+		Skipped: true,
+	}
+	b.settle(host, role, task.Name, out)
+
+	log.Infof("%s: %s.%s: %s", host, role, task.Name, out.Status())
+	return out
+}
+
+// await waits for the tasks of other hosts that are referenced, if the host
+// is applied in parallel with other hosts.  The outputs of every host so far
+// are available to the tasks that follow.
+func (b *Blueprint) await(host string, refs []*outputs.Reference) error {
+	if b.schedule == nil {
+		return nil
+	}
+
+	output, err := b.schedule.wait(host, refs)
+	if err != nil {
+		return err
+	}
+
+	b.output = output
+	return nil
+}
+
+// settle records the output of a task, if any, so that tasks on other hosts
+// can refer to it.
+func (b *Blueprint) settle(host string, role string, task string, out *outputs.Output) {
+	if out != nil {
+		b.output = append(b.output, out)
+	}
+
+	if b.schedule != nil {
+		b.schedule.settle(host, role, task, out)
+	}
+}
+
+// Facts gathers the facts for a host without applying anything.  The host
+// isn't contacted if the blueprint is evaluated against cached facts.
+func (b *Blueprint) Facts(name string) (facts *fact.Facts, err error) {
+	host, err := b.decodeHost(name)
 	if err != nil {
 		return nil, err
 	}
 
+	if b.opts.CachedFacts {
+		return b.cachedFacts(host.Name)
+	}
+
 	err = host.Connector.Dial()
 	if err != nil {
 		return nil, err
@@ -283,79 +655,167 @@ func (b *Blueprint) Apply(name string, o outputs.Outputs) (output outputs.Output
 	}
 	defer errorx.Defer(ctrl.Close, &err)
 
-	factsData, err := ctrl.Call(&rpc.FunctionCall{
-		Function: "gather_facts",
-	})
+	facts, err = b.gatherFacts(ctrl)
 	if err != nil {
 		return nil, err
 	}
 
-	var facts fact.Facts
-	err = json.Unmarshal(factsData, &facts)
+	b.cacheFacts(host.Name, facts)
+	return facts, nil
+}
+
+func (b *Blueprint) decodeHost(name string) (*hosts.Host, error) {
+	err := b.Includes.Decode(b.evalContext)
 	if err != nil {
 		return nil, err
 	}
-	b.facts = &facts
 
-	b.functions = assoc.Merge(b.functions, host.Connector.Functions())
+	err = b.Config.Decode(b.evalContext)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, binding := range b.Bindings {
-		if !binding.Match(host) {
-			continue
-		}
+	err = b.Variables.Decode(b.evalContext)
+	if err != nil {
+		return nil, err
+	}
 
-		err := binding.Decode(b.evalContext)
+	host, ok := seq.FindBy(b.Hosts, func(h *hosts.Host) bool {
+		return h.Name == name
+	})
+	if !ok {
+		return nil, errors.Errorf("invalid host: %s", name)
+	}
+
+	err = host.Decode(b.evalContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// Facts are reused from the cache if they were gathered within the configured
+// TTL, unless a refresh is requested.  Dry runs may also be evaluated against
+// cached facts regardless of their age.
+func (b *Blueprint) loadFacts(name string, ctrl *controller.Controller) (*fact.Facts, error) {
+	if b.opts.CachedFacts {
+		return b.cachedFacts(name)
+	}
+
+	if b.Config.FactCacheMaxAge > 0 && !b.opts.RefreshFacts {
+		cache, err := b.factCache()
 		if err != nil {
 			return nil, err
 		}
 
-		for _, role := range binding.Roles {
-			for _, task := range role.Tasks {
-				err := task.Decode(role.Name, host.Name, b.evalContext, b.Config)
-				if err != nil {
-					return nil, err
-				}
+		cached, err := cache.Read(name)
+		if err != nil {
+			log.Warnf("%s: ignoring cached facts: %s", name, err)
+		} else if cached != nil && cached.Age() < b.Config.FactCacheMaxAge {
+			log.Debugf("%s: using facts cached at %s", name, cached.GatheredAt.Format(state.TimeFormat))
+			return cached.Facts, nil
+		}
+	}
 
-				if !task.Include() {
-					continue
-				}
+	facts, err := b.gatherFacts(ctrl)
+	if err != nil {
+		return nil, err
+	}
 
-				out, err := task.Apply(ctrl)
-				if err != nil {
-					return nil, errors.Errorf("%s: %s.%s: %s", host.Name, role.Name, task.Name, err)
-				}
+	b.cacheFacts(name, facts)
+	return facts, nil
+}
 
-				b.output = append(b.output, out)
-				output = append(output, out)
+func (b *Blueprint) cachedFacts(name string) (*fact.Facts, error) {
+	cache, err := b.factCache()
+	if err != nil {
+		return nil, err
+	}
 
-				status := "up-to-date"
-				if out.IsChanged() {
-					status = "changed"
-				}
-				log.Infof("%s: %s.%s: %s", host.Name, role.Name, task.Name, status)
-				for typ, diffs := range out.Differences() {
-					if len(diffs) > 0 {
-						log.Infof("    %s\n    %s\n", typ, strings.Repeat("-", len(typ)))
-
-						for _, diff := range diffs {
-							log.Infof("    %s", diff)
-						}
-						log.Info()
-					}
-				}
-			}
+	cached, err := cache.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return nil, errors.Errorf("%s: no cached facts", name)
+	}
+
+	if b.Config.FactCacheMaxAge > 0 && cached.Age() >= b.Config.FactCacheMaxAge {
+		log.Warnf("%s: cached facts are stale (gathered at %s)",
+			name, cached.GatheredAt.Format(state.TimeFormat))
+	}
+
+	return cached.Facts, nil
+}
+
+// Failing to cache facts isn't fatal since they're gathered again whenever
+// there are no cached facts.
+func (b *Blueprint) cacheFacts(name string, facts *fact.Facts) {
+	cache, err := b.factCache()
+	if err == nil {
+		err = cache.Write(name, facts)
+	}
+
+	if err != nil {
+		log.Warnf("%s: unable to cache facts: %s", name, err)
+	}
+}
+
+func (b *Blueprint) factCache() (*state.FactCache, error) {
+	var keys *blob.Keyring
+	if b.Config.FactCacheSeal {
+		var err error
+		keys, err = blob.ReadKeyring(b.Config.PrivateKey, b.Config.PublicKeys)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return output, nil
+	return state.NewFactCache(b.stateDir(), keys), nil
+}
+
+// The state directory belongs to the controller rather than to a blueprint,
+// so facts are cached in the state directory of the configuration file even
+// if a blueprint has a config block of its own.  It's the directory that runs
+// are recorded in and that is shared with the sandbox.
+func (b *Blueprint) stateDir() string {
+	if b.opts.Config != nil && b.opts.Config.StateDir != "" {
+		return b.opts.Config.StateDir
+	}
+	return b.Config.StateDir
 }
 
-func (b *Blueprint) evalContext() (*hcl.EvalContext, error) {
+func (b *Blueprint) gatherFacts(ctrl *controller.Controller) (*fact.Facts, error) {
+	data, err := ctrl.Call(&rpc.FunctionCall{
+		Function: "gather_facts",
+		Params: &fact.Executor{
+			FactsDir: b.Config.FactsDir,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var facts fact.Facts
+	err = json.Unmarshal(data, &facts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &facts, nil
+}
+
+func (b *Blueprint) evalContext(body hcl.Body) (*hcl.EvalContext, error) {
 	ctx := &hcl.EvalContext{
 		Functions: b.functions,
 		Variables: map[string]cty.Value{},
 	}
 
+	if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+		ctx.Functions = assoc.Merge(b.functions, b.fileFunctions(syntaxBody))
+	}
+
 	facts, err := b.facts.Variables()
 	if err != nil {
 		return nil, err
@@ -1,51 +1,341 @@
 package blueprint
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/orch/src/bindings"
+	"github.com/illikainen/orch/src/hosts"
+	"github.com/illikainen/orch/src/roles"
+	"github.com/illikainen/orch/src/tasks"
+	"github.com/illikainen/orch/src/tasks/outputs"
+
+	"github.com/hashicorp/hcl/v2"
 	"github.com/illikainen/go-utils/src/seq"
 )
 
-type Dependencies map[string][]string
+// CircularDependencyError is returned by PartialDecode() if tasks depend on
+// each other, either directly or through the order of the tasks on a host.
+// There's a diagnostic for every edge in the cycle.
+type CircularDependencyError struct {
+	Cycle       []string
+	Diagnostics hcl.Diagnostics
+}
 
-func (d *Dependencies) Filter(hosts []string) Dependencies {
-	deps := Dependencies{}
-	for host, depHosts := range *d {
-		deps[host] = seq.Filter(depHosts, hosts...)
+func (e *CircularDependencyError) Error() string {
+	reasons := []string{}
+	for _, diag := range e.Diagnostics {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", diag.Subject, strings.TrimSuffix(diag.Detail, ".")))
 	}
 
-	return deps
+	return fmt.Sprintf("circular dependency: %s (%s)", strings.Join(e.Cycle, " -> "), strings.Join(reasons, "; "))
 }
 
-func (d *Dependencies) FindCircularDependencies() (bool, string) {
-	visited := map[string]bool{}
-	cur := map[string]bool{}
+type Dependencies map[string][]string
 
+// FindCircularDependencies returns the first circular dependency as a path
+// that starts and ends with the same node, e.g., `web1 -> db1 -> web1'.  Nodes
+// are visited in sorted order so that the same cycle is always reported.
+func (d *Dependencies) FindCircularDependencies() []string {
+	hosts := []string{}
 	for host := range *d {
-		if circular := d.visitCircularDependencies(host, visited, cur); circular {
-			return circular, host
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	visited := map[string]bool{}
+	for _, host := range hosts {
+		if cycle := d.visitCircularDependencies(host, visited, nil); cycle != nil {
+			return cycle
 		}
 	}
 
-	return false, ""
+	return nil
 }
 
-func (d *Dependencies) visitCircularDependencies(host string, visited map[string]bool,
-	cur map[string]bool) bool {
-	if cur[host] {
-		return true
+func (d *Dependencies) visitCircularDependencies(host string, visited map[string]bool, path []string) []string {
+	for i, elt := range path {
+		if elt == host {
+			return append(append([]string{}, path[i:]...), host)
+		}
 	}
 
 	if visited[host] {
-		return false
+		return nil
 	}
 
-	cur[host] = true
+	path = append(path, host)
 	for _, depHost := range (*d)[host] {
-		if circular := d.visitCircularDependencies(depHost, visited, cur); circular {
-			return true
+		if cycle := d.visitCircularDependencies(depHost, visited, path); cycle != nil {
+			return cycle
 		}
 	}
 
-	cur[host] = false
 	visited[host] = true
-	return false
+	return nil
+}
+
+// Reaches checks whether a node depends on another node, directly or through
+// other nodes.
+func (d *Dependencies) Reaches(from string, to string) bool {
+	visited := map[string]bool{}
+
+	var visit func(host string) bool
+	visit = func(host string) bool {
+		if host == to {
+			return true
+		}
+
+		if visited[host] {
+			return false
+		}
+		visited[host] = true
+
+		for _, dep := range (*d)[host] {
+			if visit(dep) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return visit(from)
+}
+
+// boundTask is a task of a role that is bound to a host.
+type boundTask struct {
+	binding *bindings.Binding
+	role    *roles.Role
+	task    *tasks.Task
+}
+
+// boundTasks returns the tasks of a host in the order that they're applied.
+func (b *Blueprint) boundTasks(host *hosts.Host) []*boundTask {
+	bound := []*boundTask{}
+	for _, elt := range b.bound[host.Name] {
+		for _, task := range elt.Role.Tasks {
+			bound = append(bound, &boundTask{binding: elt.Binding, role: elt.Role, task: task})
+		}
+	}
+	return bound
+}
+
+// dependencyReason is an `out.*' reference that makes a host or a task depend
+// on another, along with a description of where it's made.
+type dependencyReason struct {
+	ref   *outputs.Reference
+	where string
+}
+
+func (b *Blueprint) dependencyReasons(host *hosts.Host, dep string) []*dependencyReason {
+	reasons := []*dependencyReason{}
+	for _, reason := range b.hostReasons(host) {
+		if reason.ref.Host == dep {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// hostReasons returns every reference that a host and the bindings, roles
+// and tasks that are bound to it make.
+func (b *Blueprint) hostReasons(host *hosts.Host) []*dependencyReason {
+	reasons := referenceReasons(host.References, hostWhere(host))
+
+	decoded := map[string]bool{}
+	for _, elt := range b.bound[host.Name] {
+		if !decoded[elt.Binding.Name] {
+			reasons = append(reasons, bindingReasons(elt.Binding)...)
+			decoded[elt.Binding.Name] = true
+		}
+	}
+
+	for _, bound := range b.boundTasks(host) {
+		reasons = append(reasons, referenceReasons(bound.task.References, bound.where())...)
+	}
+
+	return reasons
+}
+
+// bindingReasons returns the references that are evaluated when a binding is
+// decoded.
+func bindingReasons(binding *bindings.Binding) []*dependencyReason {
+	reasons := referenceReasons(binding.References, fmt.Sprintf("the vars of binding \"%s\"", binding.Name))
+	for _, role := range binding.Roles {
+		reasons = append(reasons, referenceReasons(role.References,
+			fmt.Sprintf("role %s in binding \"%s\"", role.Name, binding.Name))...)
+	}
+	return reasons
+}
+
+func referenceReasons(refs []*outputs.Reference, where string) []*dependencyReason {
+	reasons := []*dependencyReason{}
+	for _, ref := range refs {
+		reasons = append(reasons, &dependencyReason{ref: ref, where: where})
+	}
+	return reasons
+}
+
+// taskDependencies returns the order in which the tasks of every host are
+// applied when hosts are applied in parallel.  A task depends on the previous
+// task of its host and on the tasks that it refers to.  The first task of a
+// host also depends on the references of the host itself, and the first task
+// after a binding is decoded depends on the references in the vars of the
+// binding and in the defaults and variables of its roles.  Every host has a
+// node of its own that depends on its last task, which is what references to
+// the whole host depend on.  The reasons for each edge are keyed by
+// edgeKey().
+func (b *Blueprint) taskDependencies() (Dependencies, map[string][]*dependencyReason) {
+	deps := Dependencies{}
+	reasons := map[string][]*dependencyReason{}
+
+	refer := func(from string, host *hosts.Host, rs []*dependencyReason) {
+		for _, reason := range rs {
+			for _, to := range b.referencedTasks(host, reason.ref) {
+				deps[from] = seq.Uniq(append(deps[from], to))
+				reasons[edgeKey(from, to)] = append(reasons[edgeKey(from, to)], reason)
+			}
+		}
+	}
+
+	for _, host := range b.Hosts {
+		prev := ""
+		pending := referenceReasons(host.References, hostWhere(host))
+		decoded := map[string]bool{}
+
+		for _, elt := range b.bound[host.Name] {
+			if !decoded[elt.Binding.Name] {
+				pending = append(pending, bindingReasons(elt.Binding)...)
+				decoded[elt.Binding.Name] = true
+			}
+
+			for _, task := range elt.Role.Tasks {
+				bound := &boundTask{binding: elt.Binding, role: elt.Role, task: task}
+				id := taskNodeID(host.Name, bound.role.Name, bound.task.Name)
+				deps[id] = []string{}
+				if prev != "" {
+					deps[id] = append(deps[id], prev)
+				}
+
+				refer(id, host, pending)
+				refer(id, host, referenceReasons(task.References, bound.where()))
+				pending = nil
+				prev = id
+			}
+		}
+
+		deps[host.Name] = []string{}
+		if prev != "" {
+			deps[host.Name] = append(deps[host.Name], prev)
+		}
+		refer(host.Name, host, pending)
+	}
+
+	return deps, reasons
+}
+
+// referencedTasks returns the nodes that a reference depends on.  References
+// to a role depend on every task of the role, and references to a host depend
+// on the whole host.  References to a task or role that isn't bound to the
+// host depend on nothing; they're reported by validateReferences() rather
+// than as a cycle.
+func (b *Blueprint) referencedTasks(this *hosts.Host, ref *outputs.Reference) []string {
+	host := this
+	if ref.Host != "this" {
+		var ok bool
+		host, ok = seq.FindBy(b.Hosts, func(h *hosts.Host) bool { return h.Name == ref.Host })
+		if !ok {
+			return nil
+		}
+	}
+
+	if ref.Role == "" {
+		return []string{host.Name}
+	}
+
+	ids := []string{}
+	for _, bound := range b.boundTasks(host) {
+		if bound.role.Name == ref.Role && (ref.Task == "" || bound.task.Name == ref.Task) {
+			ids = append(ids, taskNodeID(host.Name, bound.role.Name, bound.task.Name))
+		}
+	}
+	return ids
+}
+
+// circularDependencyError describes every edge in a cycle.  Edges that are
+// made by references are reported at each reference, and edges that are made
+// by the order of the tasks on a host are reported at the task or host that
+// runs after the other.
+func (b *Blueprint) circularDependencyError(cycle []string, reasons map[string][]*dependencyReason) error {
+	diags := hcl.Diagnostics{}
+	summary := fmt.Sprintf("Circular dependency: %s", strings.Join(cycle, " -> "))
+
+	hostNodes := map[string]*hosts.Host{}
+	taskNodes := map[string]*boundTask{}
+	for _, host := range b.Hosts {
+		hostNodes[host.Name] = host
+		for _, bound := range b.boundTasks(host) {
+			taskNodes[taskNodeID(host.Name, bound.role.Name, bound.task.Name)] = bound
+		}
+	}
+
+	for i := 0; i < len(cycle)-1; i++ {
+		from, to := cycle[i], cycle[i+1]
+
+		for _, reason := range reasons[edgeKey(from, to)] {
+			detail := fmt.Sprintf("%s depends on %s through %s in %s.", from, to, reason.ref, reason.where)
+			if bound, ok := taskNodes[to]; ok {
+				detail += fmt.Sprintf("  %s is bound to %s by binding \"%s\".", to, hostOf(to), bound.binding.Name)
+			}
+
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  summary,
+				Detail:   detail,
+				Subject:  reason.ref.Range.Ptr(),
+			})
+		}
+
+		if len(reasons[edgeKey(from, to)]) > 0 {
+			continue
+		}
+
+		if bound, ok := taskNodes[from]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  summary,
+				Detail: fmt.Sprintf("%s runs after %s since %s is applied after %s on %s.",
+					from, to, bound.where(), taskNodes[to].where(), hostOf(from)),
+				Subject: bound.task.Body.MissingItemRange().Ptr(),
+			})
+		} else if host, ok := hostNodes[from]; ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  summary,
+				Detail: fmt.Sprintf("%s runs after %s since references to %s wait for its last task, %s.",
+					from, to, hostWhere(host), taskNodes[to].where()),
+				Subject: host.Body.MissingItemRange().Ptr(),
+			})
+		}
+	}
+
+	return &CircularDependencyError{Cycle: cycle, Diagnostics: diags}
+}
+
+func (t *boundTask) where() string {
+	return fmt.Sprintf("task %s.%s in binding \"%s\"", t.role.Name, t.task.Name, t.binding.Name)
+}
+
+func hostWhere(host *hosts.Host) string {
+	return fmt.Sprintf("host \"%s\"", host.Name)
+}
+
+// taskNodeID identifies a task of a host in the task dependencies.
+func taskNodeID(host string, role string, task string) string {
+	return host + ":" + role + "." + task
+}
+
+func edgeKey(from string, to string) string {
+	return from + "\x00" + to
 }
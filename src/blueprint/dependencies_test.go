@@ -0,0 +1,398 @@
+package blueprint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/pkg/errors"
+)
+
+func writeBlueprint(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "site.hcl")
+}
+
+// A role that is bound to a host by several bindings is only scheduled once,
+// so it doesn't make the tasks of the host depend on themselves.
+func TestSharedRoleDependencies(t *testing.T) {
+	path := writeBlueprint(t, map[string]string{
+		"site.hcl": `
+host "local" "a" {
+  tags = ["x"]
+}
+
+bind "one" {
+  hosts = ["a"]
+  roles = ["base", "web"]
+}
+
+bind "two" {
+  tags  = ["x"]
+  roles = ["base"]
+}
+`,
+		"base/main.hcl": `
+task "file_manage" "t1" {
+  dst     = "/tmp/x"
+  content = "x"
+}
+`,
+		"web/main.hcl": `
+task "file_manage" "w1" {
+  dst     = "/tmp/y"
+  content = "y"
+}
+`,
+	})
+
+	b := NewBlueprint(&Options{Path: path})
+	err := b.PartialDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := []string{}
+	for _, bound := range b.boundTasks(b.Hosts[0]) {
+		tasks = append(tasks, taskNodeID("a", bound.role.Name, bound.task.Name))
+	}
+	if len(tasks) != 2 || tasks[0] != "a:base.t1" || tasks[1] != "a:web.w1" {
+		t.Fatalf("tasks = %v, want [a:base.t1 a:web.w1]", tasks)
+	}
+
+	deps, _ := b.taskDependencies()
+	if cycle := deps.FindCircularDependencies(); cycle != nil {
+		t.Fatalf("unexpected cycle: %v", cycle)
+	}
+
+	if !deps.Reaches("a:web.w1", "a:base.t1") || deps.Reaches("a:base.t1", "a:web.w1") {
+		t.Errorf("a:web.w1 should run after a:base.t1: %v", deps)
+	}
+}
+
+// A role that is bound to a host by several bindings is only applied once, so
+// it can't be given vars by any of them.  Vars that are only passed to other
+// roles in the bindings are fine.
+func TestSharedRoleVars(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		one   string
+		two   string
+		valid bool
+	}{
+		{"no-vars", ``, ``, true},
+		{"other-role", `vars = { name = "web" }`, ``, true},
+		{"first", `vars = { port = "80" }`, ``, false},
+		{"second", ``, `vars = { port = "8080" }`, false},
+		{"both", `vars = { port = "80" }`, `vars = { port = "8080" }`, false},
+		{"unknown", `vars = var.vars`, ``, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeBlueprint(t, map[string]string{
+				"site.hcl": `
+var "vars" {
+  default = {}
+}
+
+host "local" "a" {
+  tags = ["x"]
+}
+
+bind "one" {
+  hosts = ["a"]
+  roles = ["base", "web"]
+  ` + test.one + `
+}
+
+bind "two" {
+  tags  = ["x"]
+  roles = ["base"]
+  ` + test.two + `
+}
+`,
+				"base/main.hcl": `
+defaults {
+  port = "22"
+}
+
+task "file_manage" "t1" {
+  dst     = "/tmp/x"
+  content = param.port
+}
+`,
+				"web/main.hcl": `
+defaults {
+  name = "default"
+}
+
+task "file_manage" "w1" {
+  dst     = "/tmp/y"
+  content = param.name
+}
+`,
+			})
+
+			b := NewBlueprint(&Options{Path: path})
+			err := b.PartialDecode()
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.valid && (err == nil || !strings.Contains(err.Error(), "can't pass vars")) {
+				t.Fatalf("expected an error about vars, got %v", err)
+			}
+		})
+	}
+}
+
+// Every edge of a cycle is reported, including the edges that are made by the
+// order of the tasks on a host and by references to a whole host.
+func TestCircularDependencyDiagnostics(t *testing.T) {
+	path := writeBlueprint(t, map[string]string{
+		"site.hcl": `
+host "ssh" "web1" {
+  tags = ["web"]
+}
+
+host "ssh" "db1" {
+  tags = ["db"]
+}
+
+bind "w" {
+  tags  = ["web"]
+  roles = ["web"]
+}
+
+bind "d" {
+  tags  = ["db"]
+  roles = ["db"]
+}
+`,
+		"web/main.hcl": `
+task "file_manage" "site" {
+  dst     = "/tmp/x"
+  content = "${out.db1.db.user.changed}"
+}
+
+task "file_manage" "other" {
+  dst     = "/tmp/y"
+  content = "y"
+}
+`,
+		"db/main.hcl": `
+task "file_manage" "user" {
+  dst     = "/tmp/z"
+  content = jsonencode(out.web1)
+}
+`,
+	})
+
+	b := NewBlueprint(&Options{Path: path})
+	err := b.PartialDecode()
+
+	circular := &CircularDependencyError{}
+	if !errors.As(err, &circular) {
+		t.Fatalf("expected a circular dependency, got %v", err)
+	}
+
+	if len(circular.Diagnostics) != len(circular.Cycle)-1 {
+		t.Fatalf("%d diagnostic(s) for %v", len(circular.Diagnostics), circular.Cycle)
+	}
+
+	for _, diag := range circular.Diagnostics {
+		if diag.Subject == nil || diag.Detail == "" {
+			t.Errorf("incomplete diagnostic: %#v", diag)
+		}
+	}
+}
+
+// The vars of a binding and the defaults of its roles are evaluated before
+// the first task of the binding, so their references are dependencies of
+// that task.
+func TestBindingReferenceDependencies(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		vars string
+		dflt string
+	}{
+		{"vars", `vars = { port = out.db1.db.user.changed }`, `"22"`},
+		{"defaults", ``, `out.db1.db.user.changed`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string]string{
+				"site.hcl": `
+host "ssh" "web1" {
+  tags = ["web"]
+}
+
+host "ssh" "db1" {
+  tags = ["db"]
+}
+
+bind "w" {
+  tags  = ["web"]
+  roles = ["web"]
+  ` + test.vars + `
+}
+
+bind "d" {
+  tags  = ["db"]
+  roles = ["db"]
+}
+`,
+				"web/main.hcl": `
+defaults {
+  port = ` + test.dflt + `
+}
+
+task "file_manage" "site" {
+  dst     = "/tmp/x"
+  content = "${param.port}"
+}
+`,
+				"db/main.hcl": `
+task "file_manage" "user" {
+  dst     = "/tmp/z"
+  content = "z"
+}
+`,
+			}
+
+			b := NewBlueprint(&Options{Path: writeBlueprint(t, files)})
+			err := b.PartialDecode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deps, reasons := b.taskDependencies()
+			if !deps.Reaches("web1:web.site", "db1:db.user") {
+				t.Errorf("web1:web.site should run after db1:db.user: %v", deps)
+			}
+
+			if len(reasons[edgeKey("web1:web.site", "db1:db.user")]) != 1 {
+				t.Errorf("the reference isn't described: %v", reasons)
+			}
+
+			// The referenced host isn't scheduled when only web1 is
+			// applied.
+			b = NewBlueprint(&Options{Path: writeBlueprint(t, files), Filter: Filter{Hosts: []string{"web1"}}})
+			err = b.PartialDecode()
+			if err == nil || !strings.Contains(err.Error(), "db1") {
+				t.Fatalf("expected an error about db1, got %v", err)
+			}
+		})
+	}
+}
+
+// Local hosts are applied one at a time before any remote host, so they may
+// only refer to the local hosts before them.
+func TestLocalHostOrder(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		from  string
+		to    string
+		valid bool
+	}{
+		{"earlier-local", "l2", "l1", true},
+		{"later-local", "l1", "l2", false},
+		{"remote", "l1", "r1", false},
+		{"remote-to-local", "r1", "l2", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeBlueprint(t, map[string]string{
+				"site.hcl": `
+host "local" "l1" {}
+host "local" "l2" {}
+host "ssh" "r1" {}
+
+bind "from" {
+  hosts = ["` + test.from + `"]
+  roles = ["from"]
+}
+
+bind "to" {
+  hosts = ["` + test.to + `"]
+  roles = ["to"]
+}
+`,
+				"from/main.hcl": `
+task "file_manage" "f" {
+  dst     = "/tmp/x"
+  content = "${out.` + test.to + `.to.t.changed}"
+}
+`,
+				"to/main.hcl": `
+task "file_manage" "t" {
+  dst     = "/tmp/y"
+  content = "y"
+}
+`,
+			})
+
+			b := NewBlueprint(&Options{Path: path})
+			err := b.PartialDecode()
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+
+			if !test.valid && (err == nil || !strings.Contains(err.Error(), "applied later")) {
+				t.Fatalf("expected an error about the order of %s and %s, got %v", test.from, test.to, err)
+			}
+		})
+	}
+}
+
+// A reference to a task that doesn't exist isn't a dependency on the whole
+// host, so a misspelled reference on the same host is reported as such rather
+// than as a cycle.
+func TestUndeclaredTaskReference(t *testing.T) {
+	path := writeBlueprint(t, map[string]string{
+		"site.hcl": `
+host "ssh" "h1" {}
+
+bind "b" {
+  hosts = ["h1"]
+  roles = ["web"]
+}
+`,
+		"web/main.hcl": `
+task "file_manage" "a" {
+  dst     = "/tmp/x"
+  content = "x"
+}
+
+task "file_manage" "c" {
+  dst     = "/tmp/y"
+  content = "${out.h1.web.zzz.changed}"
+}
+`,
+	})
+
+	b := NewBlueprint(&Options{Path: path})
+	err := b.PartialDecode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diags := b.validate()
+	if !seq.ContainsBy(diags, func(diag *hcl.Diagnostic) bool {
+		return diag.Summary == "Reference to undeclared task"
+	}) {
+		t.Fatalf("expected an undeclared task, got %v", diags)
+	}
+}
@@ -0,0 +1,173 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/illikainen/orch/src/fact"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/illikainen/go-utils/src/sandbox"
+	"github.com/pkg/errors"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	FactsFormatJSON = "json"
+	FactsFormatHCL  = "hcl"
+)
+
+// Facts gathers and prints the facts for every scheduled host.  Local hosts
+// are contacted outside of the sandbox, mirroring Apply().
+func Facts(opts *Options, format string) error {
+	if format != FactsFormatJSON && format != FactsFormatHCL {
+		return errors.Errorf("%s is not a valid format", format)
+	}
+
+	// Nothing is contacted when printing cached facts, so there's no need
+	// to sandbox ourselves.
+	if opts.CachedFacts {
+		return factsCached(opts, format)
+	}
+
+	if !sandbox.IsSandboxed() {
+		err := factsLocal(opts, format)
+		if err != nil {
+			return err
+		}
+	}
+
+	if sandbox.Compatible() && !sandbox.IsSandboxed() {
+		opts.Sandbox.SetStdout(process.TextOutput)
+		err := startSandbox(opts, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return factsRemote(opts, format)
+}
+
+func factsLocal(opts *Options, format string) error {
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		return err
+	}
+
+	for _, host := range blueprint.Hosts {
+		if host.Type == "local" {
+			facts, err := blueprint.Facts(host.Name)
+			if err != nil {
+				return err
+			}
+
+			err = printFacts(host.Name, facts, format)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func factsCached(opts *Options, format string) error {
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		return err
+	}
+
+	for _, host := range blueprint.Hosts {
+		facts, err := blueprint.Facts(host.Name)
+		if err != nil {
+			return err
+		}
+
+		err = printFacts(host.Name, facts, format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func factsRemote(opts *Options, format string) error {
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		return err
+	}
+
+	facts := make([]*fact.Facts, len(blueprint.Hosts))
+	group := errgroup.Group{}
+	for i, host := range blueprint.Hosts {
+		if host.Type == "local" {
+			continue
+		}
+
+		idx := i
+		name := host.Name
+		group.Go(func() error {
+			bp := NewBlueprint(opts)
+			if err := bp.PartialDecode(); err != nil {
+				return err
+			}
+
+			f, err := bp.Facts(name)
+			if err != nil {
+				return errors.Errorf("%s: %s", name, err)
+			}
+
+			facts[idx] = f
+			return nil
+		})
+	}
+
+	err := group.Wait()
+	if err != nil {
+		return err
+	}
+
+	for i, host := range blueprint.Hosts {
+		if facts[i] != nil {
+			err := printFacts(host.Name, facts[i], format)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func printFacts(name string, facts *fact.Facts, format string) error {
+	vars, err := facts.Variables()
+	if err != nil {
+		return err
+	}
+	value := vars["fact"]
+
+	var out string
+	switch format {
+	case FactsFormatJSON:
+		data, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			return err
+		}
+
+		doc, err := json.MarshalIndent(map[string]json.RawMessage{name: data}, "", "    ")
+		if err != nil {
+			return err
+		}
+		out = string(doc)
+	case FactsFormatHCL:
+		out = fmt.Sprintf("# %s\n%s\n", name, strings.Join(utils.CtyPaths("fact", value), "\n"))
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, out)
+	return err
+}
@@ -0,0 +1,187 @@
+package blueprint
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/illikainen/go-cryptor/src/blob"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Format rewrites the HCL files of a blueprint, its includes and its roles
+// in the canonical format.  Sealed files are unsealed, formatted and sealed
+// again with the keyring of the config.  Roles from role sources are left
+// alone since they're checked out from elsewhere.
+//
+// With check, nothing is written and it's an error if any file isn't
+// formatted.  With diff, the changes are printed on stdout.
+func Format(opts *Options, check bool, diff bool) error {
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		return err
+	}
+
+	dirs := []string{opts.Path}
+	for _, include := range blueprint.Includes {
+		dirs = append(dirs, include.Src)
+	}
+
+	for _, binding := range blueprint.Bindings {
+		for _, role := range binding.Roles {
+			if !blueprint.isRoleSource(role.Dir) {
+				dirs = append(dirs, role.Dir)
+			}
+		}
+	}
+
+	files, err := hclFiles(dirs...)
+	if err != nil {
+		return err
+	}
+
+	var keys *blob.Keyring
+	unformatted := []string{}
+	for _, file := range files {
+		data, sealed, err := seal.ReadSource(file, blueprint.Config)
+		if err != nil {
+			return err
+		}
+
+		formatted, err := formatHCL(file, data)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(data, formatted) {
+			continue
+		}
+		unformatted = append(unformatted, file)
+
+		if diff {
+			err := printFormatDiff(file, data, formatted, sealed)
+			if err != nil {
+				return err
+			}
+		}
+
+		if check {
+			log.Infof("%s is not formatted", file)
+			continue
+		}
+
+		if sealed {
+			if keys == nil {
+				keys, err = blob.ReadKeyring(blueprint.Config.PrivateKey, blueprint.Config.PublicKeys)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = seal.WriteFile(file, formatted, keys)
+		} else {
+			err = writeFormatted(file, formatted)
+		}
+		if err != nil {
+			return err
+		}
+		log.Infof("formatted %s", file)
+	}
+
+	if check && len(unformatted) > 0 {
+		return errors.Errorf("%d file(s) are not formatted", len(unformatted))
+	}
+	return nil
+}
+
+// isRoleSource checks whether a role directory is in a role source.
+func (b *Blueprint) isRoleSource(dir string) bool {
+	for _, src := range b.rolePath.Sources {
+		rel, err := filepath.Rel(src, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hclFiles returns the given files and every HCL and sealed HCL file in the
+// given directories.  Each file is only returned once.
+func hclFiles(paths ...string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			ext := strings.ToLower(filepath.Ext(p))
+			if !d.IsDir() && (p == path || ext == ".hcl" || ext == ".hclseal") {
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return err
+				}
+				seen[abs] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := []string{}
+	for file := range seen {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Files with syntax errors are rejected because hclwrite formats them
+// without complaining.
+func formatHCL(path string, data []byte) ([]byte, error) {
+	_, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return hclwrite.Format(data), nil
+}
+
+// The content of sealed files isn't shown to avoid leaking it in logs.
+func printFormatDiff(path string, data []byte, formatted []byte, sealed bool) error {
+	if sealed {
+		_, err := fmt.Printf("--- %s\n+++ %s\n(sealed)\n", path, path)
+		return err
+	}
+
+	out, err := utils.FormatDiff(utils.LineDiff(string(data), string(formatted)))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("--- %s\n+++ %s\n%s", path, path, out)
+	return err
+}
+
+// The file is replaced with the same permissions.
+func writeFormatted(path string, data []byte) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteData(path, data, stat.Mode().Perm())
+}
@@ -1,21 +1,133 @@
 package blueprint
 
 import (
+	"crypto/md5"  // #nosec G501
+	"crypto/sha1" // #nosec G505
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
 	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 func localFunctions() map[string]function.Function {
 	return map[string]function.Function{
-		"oct":   oct(),
-		"print": printer(),
+		"env":       env(),
+		"oct":       oct(),
+		"print":     printer(),
+		"sensitive": sensitive(),
+
+		// Collections
+		"alltrue":         alltrue(),
+		"anytrue":         anytrue(),
+		"chunklist":       stdlib.ChunklistFunc,
+		"coalesce":        stdlib.CoalesceFunc,
+		"coalescelist":    stdlib.CoalesceListFunc,
+		"compact":         stdlib.CompactFunc,
+		"concat":          stdlib.ConcatFunc,
+		"contains":        stdlib.ContainsFunc,
+		"distinct":        stdlib.DistinctFunc,
+		"element":         stdlib.ElementFunc,
+		"flatten":         stdlib.FlattenFunc,
+		"index":           index(),
+		"keys":            stdlib.KeysFunc,
+		"length":          length(),
+		"lookup":          stdlib.LookupFunc,
+		"merge":           stdlib.MergeFunc,
+		"range":           stdlib.RangeFunc,
+		"reverse":         stdlib.ReverseListFunc,
+		"setintersection": stdlib.SetIntersectionFunc,
+		"setproduct":      stdlib.SetProductFunc,
+		"setsubtract":     stdlib.SetSubtractFunc,
+		"setunion":        stdlib.SetUnionFunc,
+		"slice":           stdlib.SliceFunc,
+		"sort":            stdlib.SortFunc,
+		"sum":             sum(),
+		"values":          stdlib.ValuesFunc,
+		"zipmap":          stdlib.ZipmapFunc,
+
+		// Strings
+		"chomp":      stdlib.ChompFunc,
+		"endswith":   endswith(),
+		"format":     stdlib.FormatFunc,
+		"formatlist": stdlib.FormatListFunc,
+		"indent":     stdlib.IndentFunc,
+		"join":       stdlib.JoinFunc,
+		"lower":      stdlib.LowerFunc,
+		"regex":      stdlib.RegexFunc,
+		"regexall":   stdlib.RegexAllFunc,
+		"replace":    stdlib.ReplaceFunc,
+		"split":      stdlib.SplitFunc,
+		"startswith": startswith(),
+		"strlen":     stdlib.StrlenFunc,
+		"strrev":     stdlib.ReverseFunc,
+		"substr":     stdlib.SubstrFunc,
+		"title":      stdlib.TitleFunc,
+		"trim":       stdlib.TrimFunc,
+		"trimprefix": stdlib.TrimPrefixFunc,
+		"trimspace":  stdlib.TrimSpaceFunc,
+		"trimsuffix": stdlib.TrimSuffixFunc,
+		"upper":      stdlib.UpperFunc,
+
+		// Dates
+		"formatdate": stdlib.FormatDateFunc,
+		"timeadd":    stdlib.TimeAddFunc,
+
+		// Numbers
+		"abs":      stdlib.AbsoluteFunc,
+		"ceil":     stdlib.CeilFunc,
+		"floor":    stdlib.FloorFunc,
+		"log":      stdlib.LogFunc,
+		"max":      stdlib.MaxFunc,
+		"min":      stdlib.MinFunc,
+		"parseint": stdlib.ParseIntFunc,
+		"pow":      stdlib.PowFunc,
+		"signum":   stdlib.SignumFunc,
+
+		// Type conversions
+		"can":      tryfunc.CanFunc,
+		"tobool":   stdlib.MakeToFunc(cty.Bool),
+		"tolist":   stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tomap":    stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+		"tonumber": stdlib.MakeToFunc(cty.Number),
+		"toset":    stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"tostring": stdlib.MakeToFunc(cty.String),
+		"try":      tryfunc.TryFunc,
+
+		// Encoding
+		"base64decode": base64decode(),
+		"base64encode": base64encode(),
+		"csvdecode":    stdlib.CSVDecodeFunc,
+		"jsondecode":   stdlib.JSONDecodeFunc,
+		"jsonencode":   stdlib.JSONEncodeFunc,
+		"urlencode":    urlencode(),
+		"yamlencode":   yamlencode(),
+
+		// Hashing
+		"base64sha256": makeHashFunction(sha256.New, base64.StdEncoding.EncodeToString),
+		"base64sha512": makeHashFunction(sha512.New, base64.StdEncoding.EncodeToString),
+		"md5":          makeHashFunction(md5.New, hex.EncodeToString),
+		"sha1":         makeHashFunction(sha1.New, hex.EncodeToString),
+		"sha256":       makeHashFunction(sha256.New, hex.EncodeToString),
+		"sha512":       makeHashFunction(sha512.New, hex.EncodeToString),
+
+		// Networking
+		"cidrhost":    cidrhost(),
+		"cidrnetmask": cidrnetmask(),
+		"cidrsubnet":  cidrsubnet(),
 	}
 }
 
@@ -48,13 +160,15 @@ func printer() function.Function {
 	return function.New(&function.Spec{
 		Params: []function.Parameter{
 			{
-				Name: "obj",
-				Type: cty.DynamicPseudoType,
+				Name:        "obj",
+				Type:        cty.DynamicPseudoType,
+				AllowMarked: true,
 			},
 		},
 		Type: function.StaticReturnType(cty.String),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
-			data, err := ctyjson.Marshal(args[0], args[0].Type())
+			obj := utils.Redact(args[0])
+			data, err := ctyjson.Marshal(obj, obj.Type())
 			if err != nil {
 				return cty.StringVal(""), err
 			}
@@ -64,3 +178,201 @@ func printer() function.Function {
 		},
 	})
 }
+
+func sensitive() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:             "value",
+				Type:             cty.DynamicPseudoType,
+				AllowDynamicType: true,
+				AllowMarked:      true,
+				AllowNull:        true,
+				AllowUnknown:     true,
+			},
+		},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			return args[0].Type(), nil
+		},
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return utils.MarkSensitive(args[0]), nil
+		},
+	})
+}
+
+func alltrue() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "list",
+				Type: cty.List(cty.Bool),
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result := cty.True
+			for it := args[0].ElementIterator(); it.Next(); {
+				_, v := it.Element()
+				if v.IsNull() {
+					return cty.False, nil
+				}
+				result = result.And(v)
+			}
+			return result, nil
+		},
+	})
+}
+
+func anytrue() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "list",
+				Type: cty.List(cty.Bool),
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			result := cty.False
+			for it := args[0].ElementIterator(); it.Next(); {
+				_, v := it.Element()
+				if v.IsNull() {
+					continue
+				}
+				result = result.Or(v)
+			}
+			return result, nil
+		},
+	})
+}
+
+// Unlike stdlib.IndexFunc, which looks up an element by its key, index()
+// returns the position of the first element that equals a value like its
+// Terraform counterpart.
+func index() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "list",
+				Type: cty.DynamicPseudoType,
+			},
+			{
+				Name: "value",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if !args[0].Type().IsListType() && !args[0].Type().IsTupleType() {
+				return cty.NilVal, errors.Errorf("argument must be a list or tuple")
+			}
+
+			for it := args[0].ElementIterator(); it.Next(); {
+				i, v := it.Element()
+				eq, err := stdlib.Equal(v, args[1])
+				if err != nil {
+					return cty.NilVal, err
+				}
+
+				if !eq.IsKnown() {
+					return cty.UnknownVal(retType), nil
+				}
+
+				if eq.True() {
+					return i, nil
+				}
+			}
+
+			return cty.NilVal, errors.Errorf("item not found")
+		},
+	})
+}
+
+// Unlike stdlib.LengthFunc, length() also counts the characters in a string
+// and the attributes of an object like its Terraform counterpart.
+func length() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:             "value",
+				Type:             cty.DynamicPseudoType,
+				AllowDynamicType: true,
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			switch {
+			case args[0].Type() == cty.String:
+				return stdlib.Strlen(args[0])
+			case args[0].Type().IsObjectType():
+				return cty.NumberIntVal(int64(args[0].LengthInt())), nil
+			}
+			return stdlib.Length(args[0])
+		},
+	})
+}
+
+func sum() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "list",
+				Type: cty.List(cty.Number),
+			},
+		},
+		Type: function.StaticReturnType(cty.Number),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if args[0].LengthInt() == 0 {
+				return cty.NilVal, errors.Errorf("cannot sum an empty list")
+			}
+
+			result := cty.Zero
+			for it := args[0].ElementIterator(); it.Next(); {
+				_, v := it.Element()
+				if v.IsNull() {
+					return cty.NilVal, errors.Errorf("cannot sum null values")
+				}
+				result = result.Add(v)
+			}
+			return result, nil
+		},
+	})
+}
+
+func startswith() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+			{
+				Name: "prefix",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.BoolVal(strings.HasPrefix(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
+
+func endswith() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+			{
+				Name: "suffix",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.BoolVal(strings.HasSuffix(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
@@ -0,0 +1,201 @@
+package blueprint
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func base64encode() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+		},
+	})
+}
+
+func base64decode() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			data, err := base64.StdEncoding.DecodeString(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			if !utf8.Valid(data) {
+				return cty.NilVal, errors.Errorf("the decoded string is not valid UTF-8")
+			}
+
+			return cty.StringVal(string(data)), nil
+		},
+	})
+}
+
+func urlencode() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(url.QueryEscape(args[0].AsString())), nil
+		},
+	})
+}
+
+func makeHashFunction(newHash func() hash.Hash, encode func([]byte) string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "str",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			hsh := newHash()
+			_, err := hsh.Write([]byte(args[0].AsString()))
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			return cty.StringVal(encode(hsh.Sum(nil))), nil
+		},
+	})
+}
+
+func yamlencode() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name:             "value",
+				Type:             cty.DynamicPseudoType,
+				AllowNull:        true,
+				AllowDynamicType: true,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			if !args[0].IsWhollyKnown() {
+				return cty.UnknownVal(retType), nil
+			}
+
+			out := strings.Builder{}
+			err := writeYAML(&out, args[0], 0)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			return cty.StringVal(out.String()), nil
+		},
+	})
+}
+
+// The YAML is written in block style with every string and key quoted as a
+// JSON string, which is a valid YAML flow scalar.  That way we don't have to
+// care about YAML's implicit typing of plain scalars.
+func writeYAML(out *strings.Builder, value cty.Value, indent int) error {
+	pad := strings.Repeat("  ", indent)
+	typ := value.Type()
+
+	switch {
+	case value.IsNull() || !isYAMLCollection(value):
+		scalar, err := yamlScalar(value)
+		if err != nil {
+			return err
+		}
+		out.WriteString(scalar + "\n")
+	case typ.IsObjectType() || typ.IsMapType():
+		if value.LengthInt() == 0 {
+			out.WriteString("{}\n")
+			return nil
+		}
+
+		for it := value.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			key, err := json.Marshal(k.AsString())
+			if err != nil {
+				return err
+			}
+
+			out.WriteString(pad + string(key) + ":")
+			out.WriteString(fn.Ternary(isYAMLCollection(v) && v.LengthInt() > 0, "\n", " "))
+			err = writeYAML(out, v, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		if value.LengthInt() == 0 {
+			out.WriteString("[]\n")
+			return nil
+		}
+
+		for it := value.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			out.WriteString(pad + "-")
+			out.WriteString(fn.Ternary(isYAMLCollection(v) && v.LengthInt() > 0, "\n", " "))
+			err := writeYAML(out, v, indent+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isYAMLCollection(value cty.Value) bool {
+	typ := value.Type()
+	return !value.IsNull() && (typ.IsObjectType() || typ.IsMapType() || typ.IsListType() ||
+		typ.IsSetType() || typ.IsTupleType())
+}
+
+func yamlScalar(value cty.Value) (string, error) {
+	if value.IsNull() {
+		return "null", nil
+	}
+
+	switch value.Type() {
+	case cty.String:
+		data, err := json.Marshal(value.AsString())
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case cty.Number:
+		return value.AsBigFloat().Text('f', -1), nil
+	case cty.Bool:
+		if value.True() {
+			return "true", nil
+		}
+		return "false", nil
+	}
+
+	return "", errors.Errorf("unsupported type: %s", value.Type().FriendlyName())
+}
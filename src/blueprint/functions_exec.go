@@ -0,0 +1,158 @@
+package blueprint
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// The system directories that are shared with local_exec().  Symlinks, as
+// on merged-/usr systems, are recreated rather than followed.
+var localExecSystemPaths = []string{"/bin", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/sbin", "/usr"}
+
+// Secrets in the shared system directories are hidden from local_exec().
+var localExecHiddenPaths = []string{
+	"/etc/gshadow",
+	"/etc/gshadow-",
+	"/etc/orch",
+	"/etc/shadow",
+	"/etc/shadow-",
+	"/etc/ssh",
+	"/etc/ssl/private",
+	"/etc/sudoers",
+	"/etc/sudoers.d",
+}
+
+// local_exec() runs a command on the controller in its own bubblewrap
+// sandbox.  The command sees the system directories and the paths in the
+// local_exec_paths allow-list of the config read-only, with secrets such as
+// /etc/shadow and the private key hidden, a private /tmp, no network and a
+// cleared environment.  Its output may end up on remote hosts, so it's
+// unable to read anything else on the controller, such as the home
+// directory.  There's no fallback if bubblewrap is unavailable.
+func (b *Blueprint) localExec() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "cmd",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			bwrap, err := exec.LookPath("bwrap")
+			if err != nil {
+				return cty.StringVal(""), errors.Errorf("local_exec requires bubblewrap: %s", err)
+			}
+
+			cmd, err := b.localExecArgs()
+			if err != nil {
+				return cty.StringVal(""), err
+			}
+
+			cmd = append(append([]string{bwrap}, cmd...),
+				"--dev", "/dev",
+				"--proc", "/proc",
+				"--tmpfs", "/tmp",
+				"--unshare-all",
+				"--die-with-parent",
+				"--new-session",
+				"--clearenv",
+				"--setenv", "PATH", "/usr/local/bin:/usr/bin:/bin",
+				"--chdir", "/",
+				"--",
+				"/bin/sh", "-c", args[0].AsString(),
+			)
+			log.Tracef("local_exec: %s", strings.Join(cmd, " "))
+
+			out, err := process.Exec(&process.ExecOptions{
+				Command: cmd,
+			})
+			if err != nil {
+				return cty.StringVal(""), err
+			}
+
+			return cty.StringVal(strings.Trim(string(out.Stdout), "\r\n")), nil
+		},
+	})
+}
+
+// localExecArgs returns the bubblewrap arguments for the filesystem of
+// local_exec().  Paths that don't exist are skipped.
+func (b *Blueprint) localExecArgs() ([]string, error) {
+	args := []string{}
+
+	for _, path := range localExecSystemPaths {
+		stat, err := os.Lstat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		if stat.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, "--symlink", target, path)
+		} else {
+			args = append(args, "--ro-bind", path, path)
+		}
+	}
+
+	for _, path := range b.Config.LocalExecPaths {
+		args = append(args, "--ro-bind-try", path, path)
+	}
+
+	hidden := append([]string{}, localExecHiddenPaths...)
+	if b.Config.PrivateKey != "" {
+		key, err := filepath.Abs(b.Config.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		hidden = append(hidden, key)
+	}
+
+	// Hidden paths are only masked if they're inside a shared path since
+	// bubblewrap is unable to create mount points elsewhere.
+	for _, path := range hidden {
+		if !b.isLocalExecPath(path) {
+			continue
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		if stat.IsDir() {
+			args = append(args, "--tmpfs", path)
+		} else {
+			args = append(args, "--ro-bind", "/dev/null", path)
+		}
+	}
+
+	return args, nil
+}
+
+func (b *Blueprint) isLocalExecPath(path string) bool {
+	for _, dir := range append(append([]string{}, localExecSystemPaths...), b.Config.LocalExecPaths...) {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package blueprint
+
+import (
+	"encoding/base64"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/illikainen/go-utils/src/assoc"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// fileFunctionNames are the functions that read files relative to the HCL
+// file that calls them.
+var fileFunctionNames = []string{"file", "filebase64", "fileset", "secret", "templatefile"}
+
+// The file functions resolve paths relative to the HCL file that calls them
+// and refuse to read anything outside of its directory.
+func (b *Blueprint) fileFunctions(body *hclsyntax.Body) map[string]function.Function {
+	funcs := map[string]function.Function{
+		"file":       b.file(body),
+		"filebase64": b.filebase64(body),
+		"fileset":    b.fileset(body),
+		"secret":     b.secret(body),
+	}
+
+	// Templates may call every function except templatefile() itself to
+	// avoid infinite recursion.
+	funcs["templatefile"] = b.templatefile(body, assoc.Merge(b.functions, funcs))
+
+	return funcs
+}
+
+func (b *Blueprint) file(body *hclsyntax.Body) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			data, sealed, err := b.readFile(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			if !utf8.Valid(data) {
+				return cty.NilVal, errors.Errorf("%s is not valid UTF-8; use filebase64() instead",
+					args[0].AsString())
+			}
+
+			return markSealed(cty.StringVal(string(data)), sealed), nil
+		},
+	})
+}
+
+func (b *Blueprint) filebase64(body *hclsyntax.Body) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			data, sealed, err := b.readFile(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			return markSealed(cty.StringVal(base64.StdEncoding.EncodeToString(data)), sealed), nil
+		},
+	})
+}
+
+func (b *Blueprint) fileset(body *hclsyntax.Body) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "pattern",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.Set(cty.String)),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			root, err := utils.JoinCtyPath(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			rx, err := globRegexp(args[1].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			matches := []string{}
+			err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if !d.Type().IsRegular() {
+					return nil
+				}
+
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+
+				rel = filepath.ToSlash(rel)
+				if rx.MatchString(rel) {
+					matches = append(matches, rel)
+				}
+				return nil
+			})
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			if len(matches) == 0 {
+				return cty.SetValEmpty(cty.String), nil
+			}
+
+			sort.Strings(matches)
+			values := []cty.Value{}
+			for _, match := range matches {
+				values = append(values, cty.StringVal(match))
+			}
+			return cty.SetVal(values), nil
+		},
+	})
+}
+
+func (b *Blueprint) templatefile(body *hclsyntax.Body, funcs map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "vars",
+				Type: cty.DynamicPseudoType,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			vars := args[1]
+			if !vars.Type().IsObjectType() && !vars.Type().IsMapType() {
+				return cty.NilVal, errors.Errorf("invalid vars; must be an object or a map")
+			}
+
+			path, err := utils.JoinCtyPath(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			data, sealed, err := b.readFile(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			expr, diags := hclsyntax.ParseTemplate(data, path, hcl.InitialPos)
+			if diags.HasErrors() {
+				return cty.NilVal, diags
+			}
+
+			ctx := &hcl.EvalContext{
+				Functions: funcs,
+				Variables: vars.AsValueMap(),
+			}
+
+			value, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				return cty.NilVal, diags
+			}
+
+			return markSealed(value, sealed), nil
+		},
+	})
+}
+
+func (b *Blueprint) readFile(body *hclsyntax.Body, name string) ([]byte, bool, error) {
+	path, err := utils.JoinCtyPath(body, name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return seal.ReadSource(path, b.Config)
+}
+
+// The content of sealed files is considered sensitive.
+func markSealed(value cty.Value, sealed bool) cty.Value {
+	if sealed {
+		return utils.MarkSensitive(value)
+	}
+	return value
+}
+
+// Patterns support `*' and `?' within a path component and `**' for any
+// number of directories.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	rx := strings.Builder{}
+	rx.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			rx.WriteString("(?:[^/]*/)*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			rx.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			rx.WriteString("[^/]*")
+		case pattern[i] == '?':
+			rx.WriteString("[^/]")
+		default:
+			rx.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	rx.WriteString("$")
+	return regexp.Compile(rx.String())
+}
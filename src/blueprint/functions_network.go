@@ -0,0 +1,155 @@
+package blueprint
+
+import (
+	"math/big"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+func cidrhost() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "prefix",
+				Type: cty.String,
+			},
+			{
+				Name: "hostnum",
+				Type: cty.Number,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			_, network, err := net.ParseCIDR(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			var hostnum int64
+			err = gocty.FromCtyValue(args[1], &hostnum)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			ip, err := cidrHost(network, big.NewInt(hostnum))
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			return cty.StringVal(ip.String()), nil
+		},
+	})
+}
+
+func cidrnetmask() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "prefix",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			_, network, err := net.ParseCIDR(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			if len(network.Mask) != net.IPv4len {
+				return cty.NilVal, errors.Errorf("only IPv4 networks have a netmask")
+			}
+
+			return cty.StringVal(net.IP(network.Mask).String()), nil
+		},
+	})
+}
+
+func cidrsubnet() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "prefix",
+				Type: cty.String,
+			},
+			{
+				Name: "newbits",
+				Type: cty.Number,
+			},
+			{
+				Name: "netnum",
+				Type: cty.Number,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			_, network, err := net.ParseCIDR(args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			var newbits int
+			err = gocty.FromCtyValue(args[1], &newbits)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			var netnum int64
+			err = gocty.FromCtyValue(args[2], &netnum)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			ones, bits := network.Mask.Size()
+			if newbits < 0 || ones+newbits > bits {
+				return cty.NilVal, errors.Errorf("insufficient address space to extend prefix of %d by %d",
+					ones, newbits)
+			}
+
+			num := big.NewInt(netnum)
+			if num.Sign() < 0 || num.BitLen() > newbits {
+				return cty.NilVal, errors.Errorf("prefix extension of %d does not accommodate a subnet "+
+					"numbered %d", newbits, netnum)
+			}
+
+			ip := new(big.Int).SetBytes(network.IP)
+			ip.Or(ip, num.Lsh(num, uint(bits-ones-newbits)))
+
+			subnet := &net.IPNet{
+				IP:   bigToIP(ip, len(network.IP)),
+				Mask: net.CIDRMask(ones+newbits, bits),
+			}
+			return cty.StringVal(subnet.String()), nil
+		},
+	})
+}
+
+// Negative host numbers count backwards from the end of the range.
+func cidrHost(network *net.IPNet, hostnum *big.Int) (net.IP, error) {
+	ones, bits := network.Mask.Size()
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+
+	num := new(big.Int).Set(hostnum)
+	if num.Sign() < 0 {
+		num.Add(num, size)
+	}
+
+	if num.Sign() < 0 || num.Cmp(size) >= 0 {
+		return nil, errors.Errorf("prefix of %d bits cannot accommodate a host numbered %s",
+			ones, hostnum)
+	}
+
+	ip := new(big.Int).SetBytes(network.IP)
+	ip.Add(ip, num)
+	return bigToIP(ip, len(network.IP)), nil
+}
+
+func bigToIP(num *big.Int, size int) net.IP {
+	ip := make(net.IP, size)
+	num.FillBytes(ip)
+	return ip
+}
@@ -0,0 +1,81 @@
+package blueprint
+
+import (
+	"os"
+
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/utils"
+	"github.com/illikainen/orch/src/variables"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// env() reads an environment variable on the controller.  Unset variables are
+// an error rather than an empty string to catch typos and missing secrets.
+// The environment is inherited by the sandboxed subprocess, so the lookup
+// works the same way in both.
+func env() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "name",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			value, ok := os.LookupEnv(args[0].AsString())
+			if !ok {
+				return cty.NilVal, errors.Errorf("environment variable %s is not set", args[0].AsString())
+			}
+
+			return utils.MarkSensitive(cty.StringVal(value)), nil
+		},
+	})
+}
+
+// secret() looks up a key in a sealed JSON object or HCL file.  The file is
+// always unsealed with the configured keyring, regardless of its extension,
+// and its format is determined by the name without the seal extension (e.g.,
+// `db.json.seal' is JSON while `db.hclseal' is HCL).
+func (b *Blueprint) secret(body *hclsyntax.Body) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "path",
+				Type: cty.String,
+			},
+			{
+				Name: "key",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.DynamicPseudoType),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path, err := utils.JoinCtyPath(body, args[0].AsString())
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			data, err := seal.Unseal(path, b.Config)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			values, err := variables.ParseOverrideFile(seal.UnsealedName(path), data)
+			if err != nil {
+				return cty.NilVal, err
+			}
+
+			value, ok := values[args[1].AsString()]
+			if !ok {
+				return cty.NilVal, errors.Errorf("%s: no such key: %s", args[0].AsString(), args[1].AsString())
+			}
+
+			return utils.MarkSensitive(value), nil
+		},
+	})
+}
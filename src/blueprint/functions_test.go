@@ -0,0 +1,247 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/orch/src/fact"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/pkg/errors"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Every expression is evaluated in the same context as blueprint attributes,
+// and the result is compared as JSON so that lists and tuples are equal.
+var functionTests = []struct {
+	expr string
+	want string
+}{
+	// Collections
+	{`alltrue([true, true])`, `true`},
+	{`alltrue([true, false])`, `false`},
+	{`anytrue([false, true])`, `true`},
+	{`anytrue([])`, `false`},
+	{`chunklist(["a", "b", "c"], 2)`, `[["a", "b"], ["c"]]`},
+	{`coalesce(null, "a", "b")`, `"a"`},
+	{`coalescelist([], ["a"])`, `["a"]`},
+	{`compact(["a", "", "b"])`, `["a", "b"]`},
+	{`concat(["a"], ["b", "c"])`, `["a", "b", "c"]`},
+	{`contains(["a", "b"], "b")`, `true`},
+	{`distinct(["a", "b", "a"])`, `["a", "b"]`},
+	{`element(["a", "b"], 3)`, `"b"`},
+	{`flatten([["a"], ["b", ["c"]]])`, `["a", "b", "c"]`},
+	{`index(["a", "b"], "b")`, `1`},
+	{`index([1, 2], 2)`, `1`},
+	{`keys({b = 1, a = 2})`, `["a", "b"]`},
+	{`length(["a", "b"])`, `2`},
+	{`length({a = 1})`, `1`},
+	{`length("héllo")`, `5`},
+	{`lookup({a = "x"}, "b", "y")`, `"y"`},
+	{`merge({a = 1, b = 2}, {b = 3})`, `{"a": 1, "b": 3}`},
+	{`range(1, 4)`, `[1, 2, 3]`},
+	{`reverse(["a", "b"])`, `["b", "a"]`},
+	{`setintersection(["a", "b"], ["b", "c"])`, `["b"]`},
+	{`setproduct(["a"], ["b", "c"])`, `[["a", "b"], ["a", "c"]]`},
+	{`setsubtract(["a", "b"], ["a"])`, `["b"]`},
+	{`setunion(["a"], ["b"])`, `["a", "b"]`},
+	{`slice(["a", "b", "c"], 1, 3)`, `["b", "c"]`},
+	{`sort(["b", "a"])`, `["a", "b"]`},
+	{`sum([1, 2, 3.5])`, `6.5`},
+	{`values({b = 1, a = 2})`, `[2, 1]`},
+	{`zipmap(["a", "b"], [1, 2])`, `{"a": 1, "b": 2}`},
+
+	// Strings
+	{`chomp("a\n")`, `"a"`},
+	{`endswith("hello", "lo")`, `true`},
+	{`format("%s-%03d", "a", 7)`, `"a-007"`},
+	{`formatlist("%s!", ["a", "b"])`, `["a!", "b!"]`},
+	{`indent(2, "a\nb")`, `"a\n  b"`},
+	{`join(",", ["a", "b"])`, `"a,b"`},
+	{`lower("ABC")`, `"abc"`},
+	{`regex("[0-9]+", "ab123cd")`, `"123"`},
+	{`regexall("[0-9]", "a1b2")`, `["1", "2"]`},
+	{`replace("a-b-c", "-", "_")`, `"a_b_c"`},
+	{`split(",", "a,b")`, `["a", "b"]`},
+	{`startswith("hello", "he")`, `true`},
+	{`strlen("héllo")`, `5`},
+	{`strrev("abc")`, `"cba"`},
+	{`substr("hello", 1, 3)`, `"ell"`},
+	{`title("hello world")`, `"Hello World"`},
+	{`trim("?!a?!", "!?")`, `"a"`},
+	{`trimprefix("foobar", "foo")`, `"bar"`},
+	{`trimspace("  a  ")`, `"a"`},
+	{`trimsuffix("foobar", "bar")`, `"foo"`},
+	{`upper("abc")`, `"ABC"`},
+
+	// Dates
+	{`formatdate("YYYY-MM-DD", "2024-01-02T03:04:05Z")`, `"2024-01-02"`},
+	{`timeadd("2024-01-02T03:04:05Z", "1h")`, `"2024-01-02T04:04:05Z"`},
+
+	// Numbers
+	{`abs(-2)`, `2`},
+	{`ceil(1.2)`, `2`},
+	{`floor(1.8)`, `1`},
+	{`log(8, 2)`, `3`},
+	{`max(1, 3, 2)`, `3`},
+	{`min(1, 3, 2)`, `1`},
+	{`parseint("ff", 16)`, `255`},
+	{`pow(2, 10)`, `1024`},
+	{`signum(-5)`, `-1`},
+
+	// Type conversions
+	{`can(tonumber("a"))`, `false`},
+	{`tobool("true")`, `true`},
+	{`tolist(["a"])`, `["a"]`},
+	{`tomap({a = "b"})`, `{"a": "b"}`},
+	{`tonumber("42")`, `42`},
+	{`toset(["b", "a", "b"])`, `["a", "b"]`},
+	{`tostring(42)`, `"42"`},
+	{`try(tonumber("a"), 0)`, `0`},
+
+	// Encoding
+	{`base64decode("aGVsbG8=")`, `"hello"`},
+	{`base64encode("hello")`, `"aGVsbG8="`},
+	{`csvdecode("a,b\n1,2\n")`, `[{"a": "1", "b": "2"}]`},
+	{`jsondecode("{\"a\": [1]}")`, `{"a": [1]}`},
+	{`jsonencode({a = [1]})`, `"{\"a\":[1]}"`},
+	{`urlencode("a b&c")`, `"a+b%26c"`},
+	{`yamlencode({a = [1, "b"]})`, `"\"a\":\n  - 1\n  - \"b\"\n"`},
+
+	// Hashing
+	{`base64sha256("hello")`, `"LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="`},
+	{`base64sha512("hello")`,
+		`"m3HSJL1i83hdltRq0+o9czGb+8KJDKra4t/3JRlnPKcjI8PZm6XBHXx6zG4UuMXaDEZjR1wuXDre9G9zvN7AQw=="`},
+	{`md5("hello")`, `"5d41402abc4b2a76b9719d911017c592"`},
+	{`sha1("hello")`, `"aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"`},
+	{`sha256("hello")`, `"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`},
+	{`sha512("hello")`,
+		`"9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"`},
+
+	// Networking
+	{`cidrhost("10.0.0.0/24", 5)`, `"10.0.0.5"`},
+	{`cidrhost("10.0.0.0/24", -1)`, `"10.0.0.255"`},
+	{`cidrhost("fd00::/64", 1)`, `"fd00::1"`},
+	{`cidrnetmask("10.0.0.0/20")`, `"255.255.240.0"`},
+	{`cidrsubnet("10.0.0.0/16", 8, 2)`, `"10.0.2.0/24"`},
+	{`cidrsubnet("fd00::/56", 8, 1)`, `"fd00:0:0:1::/64"`},
+}
+
+// Functions that aren't pure, or that are covered elsewhere.
+var untestedFunctions = []string{"env", "local_exec", "oct", "print", "sensitive"}
+
+func TestFunctions(t *testing.T) {
+	b := NewBlueprint(&Options{})
+	b.facts = &fact.Facts{}
+
+	for _, test := range functionTests {
+		t.Run(test.expr, func(t *testing.T) {
+			got, err := evalFunction(b, test.expr)
+			if err != nil {
+				t.Fatalf("%s: %v", test.expr, err)
+			}
+
+			var want any
+			err = json.Unmarshal([]byte(test.want), &want)
+			if err != nil {
+				t.Fatalf("%s: bad want: %v", test.expr, err)
+			}
+
+			if !jsonEqual(got, want) {
+				t.Errorf("%s = %s, want %s", test.expr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFunctionsCovered(t *testing.T) {
+	for name := range localFunctions() {
+		if seq.Contains(untestedFunctions, name) {
+			continue
+		}
+
+		found := false
+		for _, test := range functionTests {
+			if strings.HasPrefix(test.expr, name+"(") {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("%s has no test", name)
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	b := NewBlueprint(&Options{})
+	b.facts = &fact.Facts{}
+
+	for _, expr := range []string{
+		`sum([])`,
+		`index(["a"], "b")`,
+		`base64decode("/w==")`,
+		`cidrnetmask("fd00::/64")`,
+		`cidrsubnet("10.0.0.0/30", 4, 0)`,
+		`cidrsubnet("10.0.0.0/16", 2, 4)`,
+		`regex("[0-9]+", "abc")`,
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := evalFunction(b, expr)
+			if err == nil {
+				t.Errorf("%s: expected an error", expr)
+			}
+		})
+	}
+}
+
+func evalFunction(b *Blueprint, expr string) (string, error) {
+	file, diags := hclsyntax.ParseConfig([]byte("value = "+expr+"\n"), "test.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return "", errors.Errorf("unexpected body: %T", file.Body)
+	}
+
+	ctx, err := b.evalContext(body)
+	if err != nil {
+		return "", err
+	}
+
+	value, diags := body.Attributes["value"].Expr.Value(ctx)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	data, err := ctyjson.Marshal(value, value.Type())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func jsonEqual(got string, want any) bool {
+	var value any
+	err := json.Unmarshal([]byte(got), &value)
+	if err != nil {
+		return false
+	}
+
+	a, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+
+	b, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	return string(a) == string(b)
+}
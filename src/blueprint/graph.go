@@ -0,0 +1,245 @@
+package blueprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	GraphFormatDOT  = "dot"
+	GraphFormatJSON = "json"
+	GraphLevelHost  = "host"
+	GraphLevelTask  = "task"
+)
+
+// DependencyGraph is the order in which hosts or tasks are applied.  An edge
+// from one node to another means that the first waits for the second.
+type DependencyGraph struct {
+	Nodes []*GraphNode `json:"nodes"`
+	Edges []*GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	Role string `json:"role,omitempty"`
+	Task string `json:"task,omitempty"`
+}
+
+// GraphEdge is a dependency along with the source ranges of the `out.*'
+// references that introduced it.  Cycle is true if the edge is part of a
+// circular dependency.
+type GraphEdge struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Cycle   bool     `json:"cycle"`
+	Sources []string `json:"sources"`
+}
+
+// Graph prints the dependencies between the hosts, or between the tasks of
+// the hosts, of a blueprint without contacting them.  References in host
+// blocks are only shown at the host level since they aren't made by a task.
+func Graph(opts *Options, level string, format string) error {
+	if format != GraphFormatDOT && format != GraphFormatJSON {
+		return errors.Errorf("%s is not a valid format", format)
+	}
+
+	// Circular dependencies are shown in the graph rather than rejected.
+	blueprint := NewBlueprint(opts)
+	if err := blueprint.PartialDecode(); err != nil {
+		circular := &CircularDependencyError{}
+		if !errors.As(err, &circular) {
+			return err
+		}
+		log.Warnf("%s", err)
+	}
+
+	deps, reasons := blueprint.taskDependencies()
+
+	var graph *DependencyGraph
+	switch level {
+	case GraphLevelHost:
+		graph = blueprint.hostGraph()
+	case GraphLevelTask:
+		graph = blueprint.taskGraph(reasons)
+	default:
+		return errors.Errorf("%s is not a valid level", level)
+	}
+	graph.markCycles(level, deps, reasons)
+
+	var out string
+	switch format {
+	case GraphFormatJSON:
+		data, err := json.MarshalIndent(graph, "", "    ")
+		if err != nil {
+			return err
+		}
+		out = string(data)
+	case GraphFormatDOT:
+		out = graph.dot()
+	}
+
+	_, err := fmt.Fprintln(os.Stdout, out)
+	return err
+}
+
+func (b *Blueprint) hostGraph() *DependencyGraph {
+	graph := &DependencyGraph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	for _, host := range b.Hosts {
+		graph.Nodes = append(graph.Nodes, &GraphNode{ID: host.Name, Host: host.Name})
+
+		for _, dep := range b.Dependencies[host.Name] {
+			sources := []string{}
+			for _, reason := range b.dependencyReasons(host, dep) {
+				sources = append(sources, reason.ref.Range.String())
+			}
+
+			graph.Edges = append(graph.Edges, &GraphEdge{
+				From:    host.Name,
+				To:      dep,
+				Sources: seq.Uniq(sources),
+			})
+		}
+	}
+
+	graph.sort()
+	return graph
+}
+
+// Only the references between tasks are shown, not the order of the tasks on
+// each host.  Hosts are only shown if they're referenced as a whole or if they
+// have no tasks to make their references.
+func (b *Blueprint) taskGraph(reasons map[string][]*dependencyReason) *DependencyGraph {
+	graph := &DependencyGraph{Nodes: []*GraphNode{}, Edges: []*GraphEdge{}}
+	for key, rs := range reasons {
+		from, to, _ := strings.Cut(key, "\x00")
+
+		sources := []string{}
+		for _, reason := range rs {
+			sources = append(sources, reason.ref.Range.String())
+		}
+
+		graph.Edges = append(graph.Edges, &GraphEdge{From: from, To: to, Sources: seq.Uniq(sources)})
+	}
+	graph.sort()
+
+	for _, host := range b.Hosts {
+		for _, bound := range b.boundTasks(host) {
+			graph.Nodes = append(graph.Nodes, &GraphNode{
+				ID:   taskNodeID(host.Name, bound.role.Name, bound.task.Name),
+				Host: host.Name,
+				Role: bound.role.Name,
+				Task: bound.task.Name,
+			})
+		}
+
+		if seq.ContainsBy(graph.Edges, func(e *GraphEdge) bool { return e.From == host.Name || e.To == host.Name }) {
+			graph.Nodes = append(graph.Nodes, &GraphNode{ID: host.Name, Host: host.Name})
+		}
+	}
+
+	return graph
+}
+
+// markCycles marks every edge that is part of a circular dependency between
+// tasks.  An edge between hosts is marked if any of the references between
+// their tasks is.
+func (g *DependencyGraph) markCycles(level string, deps Dependencies, reasons map[string][]*dependencyReason) {
+	if deps.FindCircularDependencies() == nil {
+		return
+	}
+
+	cyclic := []string{}
+	for key := range reasons {
+		from, to, _ := strings.Cut(key, "\x00")
+		if deps.Reaches(to, from) {
+			cyclic = append(cyclic, key)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		for _, key := range cyclic {
+			from, to, _ := strings.Cut(key, "\x00")
+			if level == GraphLevelHost {
+				from, to = hostOf(from), hostOf(to)
+			}
+
+			if edge.From == from && edge.To == to {
+				edge.Cycle = true
+			}
+		}
+	}
+}
+
+func hostOf(id string) string {
+	host, _, _ := strings.Cut(id, ":")
+	return host
+}
+
+func (g *DependencyGraph) sort() {
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// Tasks are grouped by host, and edges in cycles are red.
+func (g *DependencyGraph) dot() string {
+	lines := []string{"digraph orch {"}
+
+	hostNames := []string{}
+	for _, node := range g.Nodes {
+		if !seq.Contains(hostNames, node.Host) {
+			hostNames = append(hostNames, node.Host)
+		}
+	}
+
+	for i, host := range hostNames {
+		indent := "\t"
+		if g.hasTasks() {
+			lines = append(lines, fmt.Sprintf("\tsubgraph \"cluster_%d\" {", i),
+				fmt.Sprintf("\t\tlabel = %q;", host))
+			indent = "\t\t"
+		}
+
+		for _, node := range g.Nodes {
+			if node.Host != host {
+				continue
+			}
+
+			if node.Task != "" {
+				lines = append(lines, fmt.Sprintf("%s%q [label=%q];", indent, node.ID, node.Role+"."+node.Task))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s%q;", indent, node.ID))
+			}
+		}
+
+		if g.hasTasks() {
+			lines = append(lines, "\t}")
+		}
+	}
+
+	for _, edge := range g.Edges {
+		attrs := ""
+		if edge.Cycle {
+			attrs = " [color=red]"
+		}
+		lines = append(lines, fmt.Sprintf("\t%q -> %q%s;", edge.From, edge.To, attrs))
+	}
+
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n")
+}
+
+func (g *DependencyGraph) hasTasks() bool {
+	return seq.ContainsBy(g.Nodes, func(n *GraphNode) bool { return n.Task != "" })
+}
@@ -0,0 +1,72 @@
+package blueprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/seq"
+)
+
+// Hash returns a checksum of every file that makes up the blueprint, i.e., the
+// blueprint itself, its includes and the directories of all bound roles.  It
+// must be called after PartialDecode().
+func (b *Blueprint) Hash() (string, error) {
+	roots := []string{b.opts.Path}
+	for _, include := range b.Includes {
+		roots = append(roots, include.Src)
+	}
+	for _, binding := range b.Bindings {
+		for _, role := range binding.Roles {
+			roots = append(roots, role.Dir)
+		}
+	}
+
+	files := []string{}
+	for _, root := range seq.Uniq(roots) {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if b.opts.AllowMissing && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			if d.Type().IsRegular() {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	files = seq.Uniq(files)
+	sort.Strings(files)
+
+	hsh := sha256.New()
+	for _, file := range files {
+		data, err := iofs.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = fmt.Fprintf(hsh, "%s\x00%d\x00", file, len(data))
+		if err != nil {
+			return "", err
+		}
+
+		_, err = hsh.Write(data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hsh.Sum(nil)), nil
+}
@@ -0,0 +1,139 @@
+package blueprint
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/illikainen/orch/src/tasks/outputs"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// schedule is shared by hosts that are applied in parallel.  Every task
+// waits for the outputs that it refers to rather than for the whole host, so
+// hosts can make progress in parallel and refer to each other as long as
+// their tasks don't.  Circular dependencies between tasks are rejected by
+// PartialDecode(), so waiting can't deadlock.
+type schedule struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	output  outputs.Outputs
+	settled map[string]bool
+	tasks   map[string][]string
+	done    map[string]error
+}
+
+// newSchedule starts a schedule with the output of the hosts that are already
+// applied.  Local hosts are applied before any remote host.
+func newSchedule(b *Blueprint, output outputs.Outputs) *schedule {
+	s := &schedule{
+		output:  append(outputs.Outputs{}, output...),
+		settled: map[string]bool{},
+		tasks:   map[string][]string{},
+		done:    map[string]error{},
+	}
+	s.cond = sync.NewCond(&s.mutex)
+
+	for _, out := range output {
+		s.settled[taskNodeID(out.Host, out.Role, out.Name)] = true
+	}
+
+	for _, host := range b.Hosts {
+		if host.Type == "local" {
+			s.done[host.Name] = nil
+		}
+
+		for _, bound := range b.boundTasks(host) {
+			s.tasks[host.Name] = append(s.tasks[host.Name],
+				taskNodeID(host.Name, bound.role.Name, bound.task.Name))
+		}
+	}
+
+	return s
+}
+
+// wait blocks until every reference is settled and returns the output of
+// every host so far.  It's an error if a referenced host failed.
+func (s *schedule) wait(host string, refs []*outputs.Reference) (outputs.Outputs, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	logged := false
+	for {
+		pending := []string{}
+		for _, ref := range refs {
+			ok, err := s.isSettled(host, ref)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				pending = append(pending, ref.String())
+			}
+		}
+
+		if len(pending) == 0 {
+			return append(outputs.Outputs{}, s.output...), nil
+		}
+
+		if !logged {
+			log.Infof("%s: waiting for %s...", host, strings.Join(pending, ", "))
+			logged = true
+		}
+		s.cond.Wait()
+	}
+}
+
+// References to a task are settled once the task is applied or skipped, and
+// references to a role once every task of the role is.  References to a
+// whole host, or to tasks and roles that aren't bound to it, are settled
+// when the host is done.  A host never waits for itself, since its own tasks
+// run in order and references to tasks that don't exist fail when the task is
+// decoded.
+func (s *schedule) isSettled(host string, ref *outputs.Reference) (bool, error) {
+	if ref.Host == "this" || ref.Host == host {
+		return true, nil
+	}
+
+	if err, ok := s.done[ref.Host]; ok {
+		return true, err
+	}
+
+	if ref.Role == "" {
+		return false, nil
+	}
+
+	prefix := taskNodeID(ref.Host, ref.Role, "")
+	found := false
+	for _, id := range s.tasks[ref.Host] {
+		if id == prefix+ref.Task || (ref.Task == "" && strings.HasPrefix(id, prefix)) {
+			found = true
+			if !s.settled[id] {
+				return false, nil
+			}
+		}
+	}
+	return found, nil
+}
+
+// settle records that a task has been handled.  Tasks that aren't included
+// have no output.
+func (s *schedule) settle(host string, role string, task string, out *outputs.Output) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if out != nil {
+		s.output = append(s.output, out)
+	}
+	s.settled[taskNodeID(host, role, task)] = true
+	s.cond.Broadcast()
+}
+
+// finish records that a host is done, successfully or not.
+func (s *schedule) finish(host string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.done[host] = err
+	s.cond.Broadcast()
+}
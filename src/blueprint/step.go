@@ -0,0 +1,69 @@
+package blueprint
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/pkg/errors"
+)
+
+// The prompt is shared by every host that is applied in parallel so that
+// only one question is asked at a time, and so that quitting aborts every
+// host rather than only the one that asked.
+var prompt = struct {
+	sync.Mutex
+	all     bool
+	aborted error
+}{}
+
+// confirmTask asks on the terminal whether a task should be applied.  The
+// terminal is opened directly because stdin may be used for other purposes.
+// Answering `c' applies the remaining tasks without asking and `q' aborts.
+func confirmTask(host string, role string, task string) (ok bool, err error) {
+	prompt.Lock()
+	defer prompt.Unlock()
+
+	if prompt.aborted != nil {
+		return false, prompt.aborted
+	}
+
+	if prompt.all {
+		return true, nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, errors.Errorf("--step requires a terminal: %s", err)
+	}
+	defer errorx.Defer(tty.Close, &err)
+
+	reader := bufio.NewReader(tty)
+	for {
+		_, err := fmt.Fprintf(tty, "%s: %s.%s: apply? [y]es, [n]o, [c]ontinue, [q]uit: ", host, role, task)
+		if err != nil {
+			return false, err
+		}
+
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "c", "continue":
+			prompt.all = true
+			return true, nil
+		case "q", "quit":
+			prompt.aborted = errors.Errorf("aborted at %s.%s on %s", role, task, host)
+			return false, prompt.aborted
+		}
+	}
+}
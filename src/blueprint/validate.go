@@ -0,0 +1,369 @@
+package blueprint
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/illikainen/orch/src/bindings"
+	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/hosts"
+	"github.com/illikainen/orch/src/roles"
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/tasks"
+	"github.com/illikainen/orch/src/tasks/outputs"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// Validate checks a blueprint without contacting any host.  Facts, outputs
+// and hosts are unknown placeholders, so attributes that depend on them are
+// type-checked rather than evaluated.  With cached facts, each host and its
+// tasks are instead evaluated against the facts in the cache.  Every
+// diagnostic is printed before returning.
+func Validate(opts *Options) error {
+	blueprint := NewBlueprint(opts)
+	err := blueprint.PartialDecode()
+	if err != nil {
+		circular := &CircularDependencyError{}
+		if errors.As(err, &circular) {
+			return reportDiagnostics(opts.Path, circular.Diagnostics, blueprint.Config)
+		}
+		return reportDiagnostics(opts.Path, appendDiagnostics(nil, err, nil), blueprint.Config)
+	}
+
+	diags := blueprint.validate()
+	if !diags.HasErrors() {
+		log.Infof("%s: ok", opts.Path)
+		return nil
+	}
+
+	return reportDiagnostics(opts.Path, diags, blueprint.Config)
+}
+
+func reportDiagnostics(path string, diags hcl.Diagnostics, config *configs.Config) error {
+	err := printDiagnostics(diags, config)
+	if err != nil {
+		return err
+	}
+
+	return errors.Errorf("%s: %d error(s)", path, len(diags.Errs()))
+}
+
+func (b *Blueprint) validate() hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	// Functions with side effects aren't called during validation, and
+	// neither are the functions of the hosts since they aren't contacted.
+	for _, name := range []string{"env", "local_exec", "print"} {
+		b.functions[name] = placeholderFunction(b.functions[name])
+	}
+
+	for _, host := range b.Hosts {
+		funcs, err := host.Functions()
+		if err != nil {
+			diags = appendDiagnostics(diags, err, host.Body.MissingItemRange().Ptr())
+			continue
+		}
+
+		for name, fun := range funcs {
+			b.functions[name] = placeholderFunction(fun)
+		}
+	}
+
+	facts, d := b.placeholderFacts()
+	diags = append(diags, d...)
+
+	ctxfn := b.placeholderContext(b.evalContext, cty.DynamicVal)
+
+	err := b.Includes.Decode(ctxfn)
+	if err != nil {
+		return appendDiagnostics(diags, err, nil)
+	}
+
+	err = b.Config.Decode(ctxfn)
+	if err != nil {
+		return appendDiagnostics(diags, err, nil)
+	}
+
+	// Nearly every expression may refer to the variables, so it's not
+	// worth continuing if any of them is invalid.
+	for _, variable := range b.Variables {
+		err := variable.Decode(ctxfn)
+		if err != nil {
+			diags = appendDiagnostics(diags, err, variable.Body.MissingItemRange().Ptr())
+		}
+	}
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, host := range b.Hosts {
+		hostFacts, ok := facts[host.Name]
+		if !ok {
+			hostFacts = cty.DynamicVal
+		}
+
+		ctx, err := b.placeholderContext(b.evalContext, hostFacts)(host.Body)
+		if err != nil {
+			return appendDiagnostics(diags, err, nil)
+		}
+
+		attrs, d := host.Body.JustAttributes()
+		diags = append(diags, d...)
+
+		for _, attr := range attrs {
+			_, d := attr.Expr.Value(ctx)
+			diags = append(diags, d...)
+		}
+		diags = append(diags, b.validateReferences(host.References, host)...)
+	}
+
+	for _, binding := range b.Bindings {
+		err := binding.Decode(ctxfn)
+		if err != nil {
+			diags = appendDiagnostics(diags, err, binding.Body.MissingItemRange().Ptr())
+			continue
+		}
+
+		matched := []*hosts.Host{}
+		for _, host := range b.Hosts {
+			if binding.Match(host) {
+				matched = append(matched, host)
+			}
+		}
+
+		for _, host := range matched {
+			diags = append(diags, b.validateReferences(binding.DecodeReferences(), host)...)
+		}
+
+		for _, role := range binding.Roles {
+			for _, task := range role.Tasks {
+				// Tasks only differ between hosts if they're evaluated
+				// against the cached facts of each host.
+				if facts == nil {
+					diags = append(diags, b.checkTask(role, task, cty.DynamicVal)...)
+				}
+
+				for _, host := range matched {
+					if facts != nil {
+						diags = append(diags, b.checkTask(role, task, facts[host.Name])...)
+					}
+
+					diags = append(diags, b.validateReferences(task.References, host)...)
+				}
+			}
+		}
+	}
+
+	return uniqueDiagnostics(diags)
+}
+
+func (b *Blueprint) checkTask(role *roles.Role, task *tasks.Task, facts cty.Value) hcl.Diagnostics {
+	err := task.Check(b.placeholderContext(role.EvalContext(b.evalContext), facts))
+	if err != nil {
+		return appendDiagnostics(nil, err, task.Body.MissingItemRange().Ptr())
+	}
+	return nil
+}
+
+// validateReferences checks that every `out.<host>.<role>.<task>' reference
+// names a role that is bound to the host and a task in that role.  References
+// to hosts that aren't scheduled are reported by PartialDecode().
+func (b *Blueprint) validateReferences(refs []*outputs.Reference, this *hosts.Host) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, ref := range refs {
+		if ref.Role == "" {
+			continue
+		}
+
+		host := this
+		if ref.Host != "this" {
+			var ok bool
+			host, ok = seq.FindBy(b.Hosts, func(h *hosts.Host) bool { return h.Name == ref.Host })
+			if !ok {
+				continue
+			}
+		}
+
+		role, ok := b.boundRole(host, ref.Role)
+		if !ok {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to unbound role",
+				Detail:   fmt.Sprintf("The role \"%s\" is not bound to \"%s\".", ref.Role, host.Name),
+				Subject:  ref.Range.Ptr(),
+			})
+			continue
+		}
+
+		if ref.Task != "" && !seq.ContainsBy(role.Tasks, func(t *tasks.Task) bool { return t.Name == ref.Task }) {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Reference to undeclared task",
+				Detail:   fmt.Sprintf("The role \"%s\" has no task \"%s\".", ref.Role, ref.Task),
+				Subject:  ref.Range.Ptr(),
+			})
+		}
+	}
+
+	return diags
+}
+
+func (b *Blueprint) boundRole(host *hosts.Host, name string) (*roles.Role, bool) {
+	bound, ok := seq.FindBy(b.bound[host.Name], func(e *bindings.Bound) bool { return e.Role.Name == name })
+	if !ok {
+		return nil, false
+	}
+	return bound.Role, true
+}
+
+// placeholderFacts returns the cached facts of every host if validation is
+// done against cached facts, and nil otherwise.  Hosts without cached facts
+// are reported and validated with unknown facts.
+func (b *Blueprint) placeholderFacts() (map[string]cty.Value, hcl.Diagnostics) {
+	if !b.opts.CachedFacts {
+		return nil, nil
+	}
+
+	var diags hcl.Diagnostics
+	facts := map[string]cty.Value{}
+	for _, host := range b.Hosts {
+		facts[host.Name] = cty.DynamicVal
+
+		cached, err := b.cachedFacts(host.Name)
+		if err != nil {
+			diags = appendDiagnostics(diags, err, host.Body.MissingItemRange().Ptr())
+			continue
+		}
+
+		vars, err := cached.Variables()
+		if err != nil {
+			diags = appendDiagnostics(diags, err, host.Body.MissingItemRange().Ptr())
+			continue
+		}
+		facts[host.Name] = vars["fact"]
+	}
+
+	return facts, diags
+}
+
+// placeholderContext wraps a context function so that outputs and hosts are
+// unknown, and facts are either unknown or the given facts.  Values that
+// haven't been decoded, such as tasks that are only type-checked, are unknown
+// as well.
+func (b *Blueprint) placeholderContext(ctxfn func(hcl.Body) (*hcl.EvalContext, error), facts cty.Value) func(
+	hcl.Body) (*hcl.EvalContext, error) {
+	return func(body hcl.Body) (*hcl.EvalContext, error) {
+		ctx, err := ctxfn(body)
+		if err != nil {
+			return nil, err
+		}
+
+		vars := map[string]cty.Value{}
+		for name, value := range ctx.Variables {
+			vars[name] = placeholderValue(value)
+		}
+
+		hostVars := map[string]cty.Value{}
+		for _, host := range b.Hosts {
+			hostVars[host.Name] = cty.DynamicVal
+		}
+
+		vars["fact"] = facts
+		vars["out"] = cty.DynamicVal
+		vars["host"] = cty.ObjectVal(hostVars)
+
+		ctx.Variables = vars
+		return ctx, nil
+	}
+}
+
+func placeholderValue(value cty.Value) cty.Value {
+	if value == cty.NilVal {
+		return cty.DynamicVal
+	}
+
+	if !value.Type().IsObjectType() || value.IsMarked() || !value.IsKnown() || value.IsNull() {
+		return value
+	}
+
+	attrs := map[string]cty.Value{}
+	for name, attr := range value.AsValueMap() {
+		attrs[name] = placeholderValue(attr)
+	}
+	return cty.ObjectVal(attrs)
+}
+
+// placeholderFunction has the signature of a function but returns an unknown
+// value instead of calling it.
+func placeholderFunction(fun function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params:   fun.Params(),
+		VarParam: fun.VarParam(),
+		Type:     fun.ReturnTypeForValues,
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.UnknownVal(retType), nil
+		},
+	})
+}
+
+// Errors that aren't diagnostics are reported at the given range, if any.
+func appendDiagnostics(diags hcl.Diagnostics, err error, rng *hcl.Range) hcl.Diagnostics {
+	if d, ok := err.(hcl.Diagnostics); ok {
+		return append(diags, d...)
+	}
+
+	return append(diags, &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  err.Error(),
+		Subject:  rng,
+	})
+}
+
+// Roles and tasks are checked once for every binding and host that includes
+// them, so the same problem may be found several times.
+func uniqueDiagnostics(diags hcl.Diagnostics) hcl.Diagnostics {
+	seen := map[string]bool{}
+	unique := hcl.Diagnostics{}
+
+	for _, diag := range diags {
+		key := fmt.Sprintf("%d\x00%s\x00%s\x00%v", diag.Severity, diag.Summary, diag.Detail, diag.Subject)
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, diag)
+		}
+	}
+
+	return unique
+}
+
+// The files are parsed again to show the source of each diagnostic.
+func printDiagnostics(diags hcl.Diagnostics, config *configs.Config) error {
+	parser := hclparse.NewParser()
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			continue
+		}
+
+		if _, ok := parser.Files()[diag.Subject.Filename]; ok {
+			continue
+		}
+
+		data, _, err := seal.ReadSource(diag.Subject.Filename, config)
+		if err != nil {
+			continue
+		}
+		_, _ = parser.ParseHCL(data, diag.Subject.Filename)
+	}
+
+	writer := hcl.NewDiagnosticTextWriter(os.Stderr, parser.Files(), 78, !color.NoColor)
+	return writer.WriteDiagnostics(diags)
+}
@@ -0,0 +1,147 @@
+package blueprint
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/illikainen/orch/src/fact"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/illikainen/go-utils/src/seq"
+)
+
+// Validation conditions may read sensitive values, and a failed condition
+// must neither reveal the value in its message nor in the diagnostic.
+func TestSensitiveVariableValidation(t *testing.T) {
+	t.Setenv("ORCH_TEST_PASSWORD", "hunter2hunter2")
+
+	for _, test := range []struct {
+		name    string
+		value   string
+		minimum string
+		valid   bool
+	}{
+		{"sensitive", `sensitive("hunter2hunter2")`, "8", true},
+		{"sensitive-invalid", `sensitive("hunter2hunter2")`, "20", false},
+		{"env", `env("ORCH_TEST_PASSWORD")`, "8", true},
+		{"env-invalid", `env("ORCH_TEST_PASSWORD")`, "20", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeBlueprint(t, map[string]string{
+				"site.hcl": `
+var "password" {
+  type    = string
+  default = ` + test.value + `
+
+  validation {
+    condition     = length(var.password) >= ` + test.minimum + `
+    error_message = "The password ${var.password} is too short."
+  }
+}
+`,
+			})
+
+			b := NewBlueprint(&Options{Path: path})
+			b.facts = &fact.Facts{}
+			err := b.PartialDecode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.Variables[0].Decode(b.evalContext)
+			if test.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !utils.IsSensitive(b.Variables[0].Value()) {
+					t.Errorf("%s is not sensitive", test.value)
+				}
+				return
+			}
+
+			diags, ok := err.(hcl.Diagnostics)
+			if !ok {
+				t.Fatalf("expected diagnostics, got %v", err)
+			}
+
+			out := bytes.Buffer{}
+			err = hcl.NewDiagnosticTextWriter(&out, nil, 78, false).WriteDiagnostics(diags)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(out.String(), "hunter2") {
+				t.Errorf("the diagnostic reveals the password:\n%s", out.String())
+			}
+
+			if !strings.Contains(diags[0].Detail, utils.Redacted) {
+				t.Errorf("the error message isn't redacted: %s", diags[0].Detail)
+			}
+		})
+	}
+}
+
+// The vars of a binding must have the type of the defaults that they
+// override.  Collections only need to be of the same kind.
+func TestRoleVarTypes(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		value string
+		dflt  string
+		valid bool
+	}{
+		{"string", `"80"`, `"22"`, true},
+		{"number", `80`, `"22"`, true},
+		{"tuple", `[80]`, `"22"`, false},
+		{"bool", `"yes"`, `true`, false},
+		{"list", `["a"]`, `[]`, true},
+		{"object", `{ a = 1 }`, `{}`, true},
+		{"not-a-list", `"a"`, `[]`, false},
+		{"not-an-object", `["a"]`, `{}`, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeBlueprint(t, map[string]string{
+				"site.hcl": `
+host "ssh" "a" {}
+
+bind "b" {
+  hosts = ["a"]
+  roles = ["base"]
+  vars  = { port = ` + test.value + ` }
+}
+`,
+				"base/main.hcl": `
+defaults {
+  port = ` + test.dflt + `
+}
+
+task "file_manage" "t1" {
+  dst     = "/tmp/x"
+  content = jsonencode(param.port)
+}
+`,
+			})
+
+			b := NewBlueprint(&Options{Path: path})
+			err := b.PartialDecode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diags := b.validate()
+			invalid := seq.ContainsBy(diags, func(diag *hcl.Diagnostic) bool {
+				return diag.Summary == "Invalid type for role variable"
+			})
+			if invalid == test.valid {
+				t.Fatalf("%s for a default of %s: %v", test.value, test.dflt, diags)
+			}
+
+			if !test.valid && diags[0].Subject.Start.Line != 7 {
+				t.Errorf("the diagnostic isn't at the vars: %v", diags[0].Subject)
+			}
+		})
+	}
+}
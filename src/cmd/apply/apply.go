@@ -16,10 +16,18 @@ var command = &cobra.Command{
 
 var options struct {
 	*rootcmd.Options
-	file   string
-	hosts  []string
-	tags   []string
-	dryRun bool
+	file         string
+	hosts        []string
+	tags         []string
+	taskTags     []string
+	skipTags     []string
+	startAtTask  string
+	step         bool
+	dryRun       bool
+	refreshFacts bool
+	cachedFacts  bool
+	vars         []string
+	varFiles     []string
 }
 
 func Command(opts *rootcmd.Options) *cobra.Command {
@@ -40,7 +48,32 @@ func init() {
 	flags.StringSliceVarP(&options.tags, "tags", "t", nil,
 		"Only apply on hosts with any of these tags(s).  May be provided multiple times")
 
+	flags.StringSliceVarP(&options.taskTags, "task-tags", "", nil,
+		"Only apply tasks with any of these tag(s).  May be provided multiple times")
+
+	flags.StringSliceVarP(&options.skipTags, "skip-tags", "", nil,
+		"Skip tasks with any of these tag(s).  May be provided multiple times")
+
+	flags.StringVarP(&options.startAtTask, "start-at-task", "", "",
+		"Skip every task before this one, given as role.task")
+
+	flags.BoolVarP(&options.step, "step", "", false, "Confirm each task before it's applied")
+
 	flags.BoolVarP(&options.dryRun, "dry-run", "d", false, "Show changes without applying them")
+
+	flags.StringArrayVarP(&options.varFiles, "var-file", "", nil,
+		"Override variables with the values in an HCL, sealed HCL or JSON file.  May be provided "+
+			"multiple times, with later files taking precedence over earlier ones")
+
+	flags.StringArrayVarP(&options.vars, "var", "", nil,
+		"Override a variable as name=value, where value is an HCL expression.  Takes precedence "+
+			"over --var-file.  May be provided multiple times")
+
+	flags.BoolVarP(&options.refreshFacts, "refresh-facts", "", false,
+		"Gather facts even if there are cached facts within the TTL")
+
+	flags.BoolVarP(&options.cachedFacts, "cached-facts", "", false,
+		"Evaluate the blueprint against cached facts instead of gathering them.  Requires --dry-run")
 }
 
 func run(cmd *cobra.Command, _ []string) error {
@@ -50,10 +83,18 @@ func run(cmd *cobra.Command, _ []string) error {
 		Path:   options.file,
 		Config: options.Config,
 		Filter: blueprint.Filter{
-			Hosts: options.hosts,
-			Tags:  options.tags,
+			Hosts:    options.hosts,
+			Tags:     options.tags,
+			TaskTags: options.taskTags,
+			SkipTags: options.skipTags,
 		},
-		Sandbox: options.Sandbox,
-		DryRun:  options.dryRun,
+		Sandbox:      options.Sandbox,
+		DryRun:       options.dryRun,
+		RefreshFacts: options.refreshFacts,
+		CachedFacts:  options.cachedFacts,
+		StartAtTask:  options.startAtTask,
+		Step:         options.step,
+		Vars:         options.vars,
+		VarFiles:     options.varFiles,
 	})
 }
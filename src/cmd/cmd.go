@@ -2,11 +2,18 @@ package cmd
 
 import (
 	applycmd "github.com/illikainen/orch/src/cmd/apply"
+	factscmd "github.com/illikainen/orch/src/cmd/facts"
+	fetchcmd "github.com/illikainen/orch/src/cmd/fetch"
+	fmtcmd "github.com/illikainen/orch/src/cmd/fmt"
 	genkeycmd "github.com/illikainen/orch/src/cmd/genkey"
+	graphcmd "github.com/illikainen/orch/src/cmd/graph"
+	historycmd "github.com/illikainen/orch/src/cmd/history"
 	rootcmd "github.com/illikainen/orch/src/cmd/root"
 	rpccmd "github.com/illikainen/orch/src/cmd/rpc"
 	sealcmd "github.com/illikainen/orch/src/cmd/seal"
+	showcmd "github.com/illikainen/orch/src/cmd/show"
 	unsealcmd "github.com/illikainen/orch/src/cmd/unseal"
+	validatecmd "github.com/illikainen/orch/src/cmd/validate"
 
 	"github.com/spf13/cobra"
 )
@@ -14,9 +21,16 @@ import (
 func Command() *cobra.Command {
 	c, opts := rootcmd.Command()
 	c.AddCommand(applycmd.Command(opts))
+	c.AddCommand(factscmd.Command(opts))
+	c.AddCommand(fetchcmd.Command(opts))
+	c.AddCommand(fmtcmd.Command(opts))
 	c.AddCommand(genkeycmd.Command(opts))
+	c.AddCommand(graphcmd.Command(opts))
+	c.AddCommand(historycmd.Command(opts))
 	c.AddCommand(rpccmd.Command(opts))
 	c.AddCommand(sealcmd.Command(opts))
+	c.AddCommand(showcmd.Command(opts))
 	c.AddCommand(unsealcmd.Command(opts))
+	c.AddCommand(validatecmd.Command(opts))
 	return c
 }
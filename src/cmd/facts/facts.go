@@ -0,0 +1,64 @@
+package factscmd
+
+import (
+	"github.com/illikainen/orch/src/blueprint"
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "facts",
+	Short: "Gather and print facts for hosts",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	file   string
+	hosts  []string
+	tags   []string
+	format string
+	cached bool
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&options.file, "file", "f", "", "Blueprint with the hosts to gather facts for")
+	fn.Must(command.MarkFlagRequired("file"))
+
+	flags.StringSliceVarP(&options.hosts, "host", "h", nil,
+		"Only gather facts for these host(s).  May be provided multiple times")
+
+	flags.StringSliceVarP(&options.tags, "tags", "t", nil,
+		"Only gather facts for hosts with any of these tags(s).  May be provided multiple times")
+
+	flags.StringVarP(&options.format, "format", "", blueprint.FactsFormatHCL,
+		"Output format (hcl, json)")
+
+	flags.BoolVarP(&options.cached, "cached", "c", false,
+		"Print cached facts without contacting the hosts")
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	return blueprint.Facts(&blueprint.Options{
+		Path:   options.file,
+		Config: options.Config,
+		Filter: blueprint.Filter{
+			Hosts: options.hosts,
+			Tags:  options.tags,
+		},
+		Sandbox:     options.Sandbox,
+		CachedFacts: options.cached,
+	}, options.format)
+}
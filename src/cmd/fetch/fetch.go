@@ -0,0 +1,43 @@
+package fetchcmd
+
+import (
+	"github.com/illikainen/orch/src/blueprint"
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "fetch",
+	Short: "Fetch the role sources of a blueprint and update its lock file",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	file string
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&options.file, "file", "f", "", "Blueprint to fetch role sources for")
+	fn.Must(command.MarkFlagRequired("file"))
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	return blueprint.Fetch(&blueprint.Options{
+		Path:    options.file,
+		Config:  options.Config,
+		Sandbox: options.Sandbox,
+	})
+}
@@ -0,0 +1,50 @@
+package fmtcmd
+
+import (
+	"github.com/illikainen/orch/src/blueprint"
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "fmt",
+	Short: "Format the HCL files of a blueprint and its roles",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	file  string
+	check bool
+	diff  bool
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&options.file, "file", "f", "", "Blueprint to format")
+	fn.Must(command.MarkFlagRequired("file"))
+
+	flags.BoolVarP(&options.check, "check", "", false,
+		"Fail if any file isn't formatted instead of rewriting it")
+
+	flags.BoolVarP(&options.diff, "diff", "", false, "Print the formatting changes")
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	return blueprint.Format(&blueprint.Options{
+		Path:    options.file,
+		Config:  options.Config,
+		Sandbox: options.Sandbox,
+	}, options.check, options.diff)
+}
@@ -0,0 +1,51 @@
+package graphcmd
+
+import (
+	"github.com/illikainen/orch/src/blueprint"
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "graph",
+	Short: "Print the dependencies between hosts or tasks",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	file   string
+	level  string
+	format string
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&options.file, "file", "f", "", "Blueprint to graph")
+	fn.Must(command.MarkFlagRequired("file"))
+
+	flags.StringVarP(&options.level, "level", "", blueprint.GraphLevelHost,
+		"Graph the dependencies between hosts or between tasks (host, task)")
+
+	flags.StringVarP(&options.format, "format", "", blueprint.GraphFormatDOT,
+		"Output format (dot, json)")
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	return blueprint.Graph(&blueprint.Options{
+		Path:    options.file,
+		Config:  options.Config,
+		Sandbox: options.Sandbox,
+	}, options.level, options.format)
+}
@@ -0,0 +1,96 @@
+package historycmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+	"github.com/illikainen/orch/src/state"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "history",
+	Short: "List previous runs",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	hosts   []string
+	changed bool
+	limit   int
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringSliceVarP(&options.hosts, "host", "h", nil,
+		"Only list runs that were applied on these host(s).  May be provided multiple times")
+
+	flags.BoolVarP(&options.changed, "changed", "c", false,
+		"Only list runs that changed something on the selected host(s)")
+
+	flags.IntVarP(&options.limit, "limit", "n", 0, "Only list the <limit> most recent runs")
+}
+
+func run(cmd *cobra.Command, _ []string) (err error) {
+	cmd.SilenceUsage = true
+
+	runs, err := state.NewStore(options.Config.StateDir).List()
+	if err != nil {
+		return err
+	}
+
+	runs = seq.FilterBy(runs, func(r *state.Run, _ int) bool {
+		if len(options.hosts) > 0 && len(seq.Intersect(options.hosts, r.Hosts)) == 0 {
+			return false
+		}
+		return !options.changed || changed(r) > 0
+	})
+
+	if options.limit > 0 && len(runs) > options.limit {
+		runs = runs[len(runs)-options.limit:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer errorx.Defer(w.Flush, &err)
+
+	_, err = fmt.Fprintln(w, "ID\tSTARTED\tSTATUS\tDRY-RUN\tCHANGED\tHOSTS")
+	if err != nil {
+		return err
+	}
+
+	for _, r := range runs {
+		_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\n", r.ID, r.StartedAt.Local().Format(state.TimeFormat),
+			r.Status, r.DryRun, changed(r), strings.Join(r.Hosts, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func changed(r *state.Run) int {
+	if len(options.hosts) == 0 {
+		return r.Changed("")
+	}
+
+	n := 0
+	for _, host := range options.hosts {
+		n += r.Changed(host)
+	}
+	return n
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/illikainen/orch/src/blueprint"
 	"github.com/illikainen/orch/src/configs"
 	"github.com/illikainen/orch/src/metadata"
+	"github.com/illikainen/orch/src/utils"
 
 	"github.com/illikainen/go-utils/src/fn"
 	"github.com/illikainen/go-utils/src/process"
@@ -63,6 +64,7 @@ func preRun(_ *cobra.Command, _ []string) error {
 		return err
 	}
 	log.SetLevel(level)
+	log.AddHook(&utils.RedactHook{})
 
 	bp := blueprint.NewBlueprint(&blueprint.Options{
 		Path:         options.config,
@@ -0,0 +1,91 @@
+package showcmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+	"github.com/illikainen/orch/src/state"
+
+	"github.com/illikainen/go-utils/src/seq"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "show <run-id>",
+	Short: "Show a previous run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	hosts []string
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringSliceVarP(&options.hosts, "host", "h", nil,
+		"Only show tasks applied on these host(s).  May be provided multiple times")
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	r, err := state.NewStore(options.Config.StateDir).Read(args[0])
+	if err != nil {
+		return err
+	}
+
+	lines := []string{
+		fmt.Sprintf("id:        %s", r.ID),
+		fmt.Sprintf("blueprint: %s", r.Blueprint),
+		fmt.Sprintf("sha256:    %s", r.Hash),
+		fmt.Sprintf("started:   %s", r.StartedAt.Local().Format(state.TimeFormat)),
+		fmt.Sprintf("finished:  %s", r.FinishedAt.Local().Format(state.TimeFormat)),
+		fmt.Sprintf("status:    %s", r.Status),
+		fmt.Sprintf("dry-run:   %t", r.DryRun),
+		fmt.Sprintf("hosts:     %s", strings.Join(r.Hosts, ", ")),
+	}
+	if r.Error != "" {
+		lines = append(lines, fmt.Sprintf("error:     %s", r.Error))
+	}
+	lines = append(lines, "")
+
+	for _, out := range r.Outputs {
+		if len(options.hosts) > 0 && !seq.Contains(options.hosts, out.Host) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s.%s: %s", out.Host, out.Role, out.Name, out.Status()))
+
+		diffs := out.Differences()
+		types := make([]string, 0, len(diffs))
+		for typ := range diffs {
+			types = append(types, typ)
+		}
+		sort.Strings(types)
+
+		for _, typ := range types {
+			if len(diffs[typ]) > 0 {
+				lines = append(lines, "    "+typ, "    "+strings.Repeat("-", len(typ)))
+				for _, diff := range diffs[typ] {
+					lines = append(lines, "    "+diff)
+				}
+				lines = append(lines, "")
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, strings.Join(lines, "\n"))
+	return err
+}
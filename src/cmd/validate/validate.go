@@ -0,0 +1,60 @@
+package validatecmd
+
+import (
+	"github.com/illikainen/orch/src/blueprint"
+	rootcmd "github.com/illikainen/orch/src/cmd/root"
+
+	"github.com/illikainen/go-utils/src/fn"
+	"github.com/spf13/cobra"
+)
+
+var command = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a blueprint without contacting any hosts",
+	RunE:  run,
+}
+
+var options struct {
+	*rootcmd.Options
+	file        string
+	vars        []string
+	varFiles    []string
+	cachedFacts bool
+}
+
+func Command(opts *rootcmd.Options) *cobra.Command {
+	options.Options = opts
+	return command
+}
+
+func init() {
+	flags := command.Flags()
+	flags.SortFlags = false
+
+	flags.StringVarP(&options.file, "file", "f", "", "Blueprint to validate")
+	fn.Must(command.MarkFlagRequired("file"))
+
+	flags.StringArrayVarP(&options.varFiles, "var-file", "", nil,
+		"Override variables with the values in an HCL, sealed HCL or JSON file.  May be provided "+
+			"multiple times, with later files taking precedence over earlier ones")
+
+	flags.StringArrayVarP(&options.vars, "var", "", nil,
+		"Override a variable as name=value, where value is an HCL expression.  Takes precedence "+
+			"over --var-file.  May be provided multiple times")
+
+	flags.BoolVarP(&options.cachedFacts, "cached-facts", "", false,
+		"Evaluate each host and its tasks against cached facts instead of unknown placeholders")
+}
+
+func run(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	return blueprint.Validate(&blueprint.Options{
+		Path:        options.file,
+		Config:      options.Config,
+		Sandbox:     options.Sandbox,
+		Vars:        options.vars,
+		VarFiles:    options.varFiles,
+		CachedFacts: options.cachedFacts,
+	})
+}
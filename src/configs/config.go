@@ -2,38 +2,130 @@ package configs
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/illikainen/orch/src/metadata"
 	"github.com/illikainen/orch/src/utils"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
 )
 
 type Config struct {
-	Body            hcl.Body    `json:"-"                 hcl:"body,remain"`
-	DefaultFileMode os.FileMode `json:"default_file_mode" cty:"default_file_mode"`
-	DefaultDirMode  os.FileMode `json:"default_dir_mode"  cty:"default_dir_mode"`
-	PrivateKey      string      `json:"private_key"       cty:"private_key"`
-	PublicKeys      []string    `json:"public_keys"       cty:"public_keys"`
-	Sandbox         string      `json:"sandbox"           cty:"sandbox"`
-	DryRun          bool        `json:"dry_run"`
-	Path            string      `json:"-"`
+	Body            hcl.Body               `json:"-"                 hcl:"body,remain"`
+	DefaultFileMode os.FileMode            `json:"default_file_mode" cty:"default_file_mode"`
+	DefaultDirMode  os.FileMode            `json:"default_dir_mode"  cty:"default_dir_mode"`
+	PrivateKey      string                 `json:"private_key"       cty:"private_key"`
+	PublicKeys      []string               `json:"public_keys"       cty:"public_keys"`
+	Sandbox         string                 `json:"sandbox"           cty:"sandbox"`
+	StateDir        string                 `json:"state_dir"         cty:"state_dir"`
+	AuditLog        string                 `json:"audit_log"         cty:"audit_log"`
+	FactsDir        string                 `json:"facts_dir"         cty:"facts_dir"`
+	FactCacheTTL    string                 `json:"fact_cache_ttl"    cty:"fact_cache_ttl"`
+	FactCacheSeal   bool                   `json:"fact_cache_seal"   cty:"fact_cache_seal"`
+	FactCacheMaxAge time.Duration          `json:"-"`
+	LocalExecPaths  []string               `json:"local_exec_paths"  cty:"local_exec_paths"`
+	RolePath        []string               `json:"role_path"   cty:"role_path"`
+	RoleSources     map[string]*RoleSource `json:"role_source" cty:"role_source"`
+	DryRun          bool                   `json:"dry_run"`
+	Path            string                 `json:"-"`
+}
+
+// RoleSource is a pinned library of roles, either in a local directory or at
+// a specific commit or tag in a git repository.
+type RoleSource struct {
+	Git  string `json:"git"`
+	Ref  string `json:"ref"`
+	Path string `json:"path"`
+}
+
+// The role search path is needed to find the roles of a blueprint before
+// anything is evaluated, so it's decoded without a context and may only
+// contain literal values.
+var roleSpec = hcldec.ObjectSpec{
+	"role_path": &hcldec.AttrSpec{
+		Name: "role_path",
+		Type: cty.List(cty.String),
+	},
+	"role_source": &hcldec.BlockMapSpec{
+		TypeName:   "role_source",
+		LabelNames: []string{"name"},
+		Nested: &hcldec.ObjectSpec{
+			"git": &hcldec.AttrSpec{
+				Name: "git",
+				Type: cty.String,
+			},
+			"ref": &hcldec.AttrSpec{
+				Name: "ref",
+				Type: cty.String,
+			},
+			"path": &hcldec.AttrSpec{
+				Name: "path",
+				Type: cty.String,
+			},
+		},
+	},
+}
+
+var keySpec = hcldec.ObjectSpec{
+	"private_key": &hcldec.AttrSpec{
+		Name: "private_key",
+		Type: cty.String,
+	},
+	"public_keys": &hcldec.AttrSpec{
+		Name: "public_keys",
+		Type: cty.List(cty.String),
+	},
 }
 
 func (c *Config) PartialDecode() error {
+	if c.Body == nil {
+		return nil
+	}
+
+	value, _, diags := hcldec.PartialDecode(c.Body, roleSpec, nil)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	body, ok := c.Body.(*hclsyntax.Body)
+	if !ok {
+		return errors.Errorf("invalid body type")
+	}
+	c.Path = body.SrcRange.Filename
+
+	err := utils.FromCtyValue(value, c)
+	if err != nil {
+		return err
+	}
+
+	// The keys are decoded early if they're literals so that sealed files
+	// can be unsealed before the rest of the blueprint is evaluated.  Keys
+	// that depend on variables are decoded later by Decode().
+	keys, _, diags := hcldec.PartialDecode(c.Body, keySpec, nil)
+	if !diags.HasErrors() {
+		err := utils.FromCtyValue(keys, c)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (c *Config) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
+func (c *Config) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
 	var ctx *hcl.EvalContext
 
 	if ctxfn != nil {
 		var err error
-		ctx, err = ctxfn()
+		ctx, err = ctxfn(c.Body)
 		if err != nil {
 			return err
 		}
@@ -51,14 +143,34 @@ func (c *Config) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
 					Name: "default_dir_mode",
 					Type: cty.Number,
 				},
-				"private_key": &hcldec.AttrSpec{
-					Name: "private_key",
+				"private_key": keySpec["private_key"],
+				"public_keys": keySpec["public_keys"],
+				"state_dir": &hcldec.AttrSpec{
+					Name: "state_dir",
 					Type: cty.String,
 				},
-				"public_keys": &hcldec.AttrSpec{
-					Name: "public_keys",
+				"audit_log": &hcldec.AttrSpec{
+					Name: "audit_log",
+					Type: cty.String,
+				},
+				"facts_dir": &hcldec.AttrSpec{
+					Name: "facts_dir",
+					Type: cty.String,
+				},
+				"fact_cache_ttl": &hcldec.AttrSpec{
+					Name: "fact_cache_ttl",
+					Type: cty.String,
+				},
+				"fact_cache_seal": &hcldec.AttrSpec{
+					Name: "fact_cache_seal",
+					Type: cty.Bool,
+				},
+				"local_exec_paths": &hcldec.AttrSpec{
+					Name: "local_exec_paths",
 					Type: cty.List(cty.String),
 				},
+				"role_path":   roleSpec["role_path"],
+				"role_source": roleSpec["role_source"],
 			},
 			ctx,
 		)
@@ -76,6 +188,16 @@ func (c *Config) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
 		if err != nil {
 			return err
 		}
+
+		paths := []string{}
+		for _, path := range c.LocalExecPaths {
+			path, err := resolvePath(filepath.Dir(c.Path), path)
+			if err != nil {
+				return errors.Wrap(err, "local_exec_paths")
+			}
+			paths = append(paths, path)
+		}
+		c.LocalExecPaths = paths
 	}
 
 	if int(c.DefaultFileMode) == 0 {
@@ -88,5 +210,107 @@ func (c *Config) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
 	}
 	log.Debugf("default dir mode: %s", c.DefaultDirMode)
 
+	if c.StateDir == "" {
+		dir, err := defaultStateDir()
+		if err != nil {
+			return err
+		}
+		c.StateDir = dir
+	}
+
+	stateDir, err := iofs.Expand(c.StateDir)
+	if err != nil {
+		return err
+	}
+	c.StateDir = stateDir
+	log.Debugf("state dir: %s", c.StateDir)
+
+	// The audit log is written by the worker on the managed host, so a
+	// relative path would depend on where the worker is started.
+	if c.AuditLog != "" && c.AuditLog != "journald" && !filepath.IsAbs(c.AuditLog) {
+		return errors.Errorf("audit_log: must be an absolute path or journald: %s", c.AuditLog)
+	}
+
+	// Cached facts are only reused if a TTL is configured.
+	if c.FactCacheTTL != "" {
+		ttl, err := time.ParseDuration(c.FactCacheTTL)
+		if err != nil {
+			return errors.Wrap(err, "fact_cache_ttl")
+		}
+		if ttl < 0 {
+			return errors.Errorf("fact_cache_ttl: negative duration: %s", c.FactCacheTTL)
+		}
+		c.FactCacheMaxAge = ttl
+	}
+	log.Debugf("fact cache ttl: %s", c.FactCacheMaxAge)
+
 	return nil
 }
+
+// RoleSearchPath returns the role path with relative directories resolved
+// against the directory of the configuration.
+func (c *Config) RoleSearchPath() ([]string, error) {
+	dirs := []string{}
+	for _, dir := range c.RolePath {
+		path, err := resolvePath(filepath.Dir(c.Path), dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "role_path")
+		}
+		dirs = append(dirs, path)
+	}
+	return dirs, nil
+}
+
+// ResolveRoleSources returns the role sources with local paths resolved
+// against the directory of the configuration.  The sources are copied rather
+// than modified since a config may be shared between blueprints.
+func (c *Config) ResolveRoleSources() (map[string]*RoleSource, error) {
+	sources := map[string]*RoleSource{}
+	for name, src := range c.RoleSources {
+		if (src.Git == "") == (src.Path == "") {
+			return nil, errors.Errorf("role_source %s: exactly one of git and path must be set", name)
+		}
+
+		if src.Git != "" && src.Ref == "" {
+			return nil, errors.Errorf("role_source %s: ref is required for git sources", name)
+		}
+
+		resolved := *src
+		if src.Path != "" {
+			path, err := resolvePath(filepath.Dir(c.Path), src.Path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "role_source %s", name)
+			}
+			resolved.Path = path
+		}
+		sources[name] = &resolved
+	}
+	return sources, nil
+}
+
+func resolvePath(basedir string, path string) (string, error) {
+	if strings.HasPrefix(path, "~"+string(os.PathSeparator)) {
+		return iofs.Expand(path)
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(basedir, path)
+	}
+
+	return filepath.Abs(path)
+}
+
+// The state directory follows the XDG base directory specification, falling
+// back to ~/.local/state if $XDG_STATE_HOME isn't set.
+func defaultStateDir() (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(base, metadata.Name()), nil
+}
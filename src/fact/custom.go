@@ -0,0 +1,143 @@
+package fact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+const customFactTimeout = 30 * time.Second
+
+// GatherCustomFacts loads every JSON file, HCL file and executable in dir.
+// Executables must print a JSON document on stdout.  A fact that fails to
+// load is logged and skipped rather than failing the whole host.
+func GatherCustomFacts(dir string) (map[string]json.RawMessage, error) {
+	facts := map[string]json.RawMessage{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Debugf("no custom facts in %s", dir)
+			return facts, nil
+		}
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		ext := strings.ToLower(filepath.Ext(path))
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+
+		var data []byte
+		switch {
+		case info.Mode().Perm()&0111 != 0:
+			data, err = execCustomFact(path)
+		case ext == ".json":
+			data, err = readJSONCustomFact(path)
+		case ext == ".hcl":
+			data, err = readHCLCustomFact(path)
+		default:
+			log.Debugf("skipping unknown custom fact %s", path)
+			continue
+		}
+		if err != nil {
+			log.Warnf("custom fact %s: %s", path, err)
+			continue
+		}
+
+		if _, ok := facts[name]; ok {
+			log.Warnf("custom fact %s: duplicate fact %s", path, name)
+			continue
+		}
+		facts[name] = data
+	}
+
+	return facts, nil
+}
+
+func execCustomFact(path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), customFactTimeout)
+	defer cancel()
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, path) // #nosec G204
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return nil, errors.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, err
+	}
+
+	if !json.Valid(stdout.Bytes()) {
+		return nil, errors.Errorf("invalid JSON output")
+	}
+	return stdout.Bytes(), nil
+}
+
+func readJSONCustomFact(path string) ([]byte, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(data) {
+		return nil, errors.Errorf("invalid JSON")
+	}
+	return data, nil
+}
+
+// HCL facts are plain attributes without any variables or functions.
+func readHCLCustomFact(path string) ([]byte, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	values := map[string]cty.Value{}
+	for name, attr := range attrs {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = value
+	}
+
+	value := cty.ObjectVal(values)
+	return ctyjson.Marshal(value, value.Type())
+}
@@ -2,7 +2,10 @@ package fact
 
 import (
 	"os"
+	"path/filepath"
+	"runtime"
 
+	"github.com/illikainen/orch/src/metadata"
 	"github.com/illikainen/orch/src/rpc/worker"
 
 	"github.com/illikainen/go-utils/src/fn"
@@ -13,12 +16,17 @@ func init() {
 }
 
 type Executor struct {
+	FactsDir string `json:"facts_dir"`
 }
 
 func NewExecutor() (worker.Executor, error) {
 	return &Executor{}, nil
 }
 
+func DefaultFactsDir() string {
+	return filepath.Join(string(filepath.Separator), "etc", metadata.Name(), "facts.d")
+}
+
 func (e *Executor) Execute() (any, error) {
 	facts := &Facts{}
 
@@ -33,5 +41,59 @@ func (e *Executor) Execute() (any, error) {
 		return nil, err
 	}
 
+	facts.Arch = runtime.GOARCH
+
+	dir := e.FactsDir
+	if dir == "" {
+		dir = DefaultFactsDir()
+	}
+
+	facts.Custom, err = GatherCustomFacts(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	facts.Interfaces, err = GatherInterfaceFacts()
+	if err != nil {
+		return nil, err
+	}
+
+	// The remaining facts are gathered from procfs and sysfs.
+	if runtime.GOOS != "linux" {
+		return facts, nil
+	}
+
+	facts.Kernel, err = GatherKernelFacts()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.CPU, err = GatherCPUFacts()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.Memory, err = GatherMemoryFacts()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.DefaultRoute, err = GatherDefaultRoute()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.DefaultRoute6, err = GatherDefaultRoute6()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.Mounts, err = GatherMountFacts()
+	if err != nil {
+		return nil, err
+	}
+
+	facts.Virtualization = GatherVirtualizationFacts()
+
 	return facts, nil
 }
@@ -1,18 +1,54 @@
 package fact
 
 import (
+	"encoding/json"
+
 	"github.com/illikainen/orch/src/utils"
 
+	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
 )
 
 type Facts struct {
-	Hostname string `cty:"hostname"`
-	OS       *OS    `cty:"os"`
+	Hostname       string       `cty:"hostname"`
+	OS             *OS          `cty:"os"`
+	Kernel         *Kernel      `cty:"kernel"`
+	Arch           string       `cty:"arch"`
+	CPU            *CPU         `cty:"cpu"`
+	Memory         *Memory      `cty:"memory"`
+	Interfaces     []*Interface `cty:"interfaces"`
+	DefaultRoute   *Route       `cty:"default_route"`
+	DefaultRoute6  *Route       `cty:"default_route6"`
+	Mounts         []*Mount     `cty:"mounts"`
+	Virtualization string       `cty:"virtualization"`
+	Custom         map[string]json.RawMessage
 }
 
 func (f *Facts) Value() (cty.Value, error) {
-	return utils.ToCtyValue(f)
+	value, err := utils.ToCtyValue(f)
+	if err != nil || f == nil {
+		return value, err
+	}
+
+	// Custom facts are arbitrary JSON documents, so their types are
+	// inferred from the data instead of being derived from a struct.
+	custom := map[string]cty.Value{}
+	for name, data := range f.Custom {
+		typ, err := ctyjson.ImpliedType(data)
+		if err != nil {
+			return cty.NilVal, errors.Wrapf(err, "custom fact %s", name)
+		}
+
+		custom[name], err = ctyjson.Unmarshal(data, typ)
+		if err != nil {
+			return cty.NilVal, errors.Wrapf(err, "custom fact %s", name)
+		}
+	}
+
+	attrs := value.AsValueMap()
+	attrs["custom"] = cty.ObjectVal(custom)
+	return cty.ObjectVal(attrs), nil
 }
 
 func (f *Facts) Variables() (map[string]cty.Value, error) {
@@ -0,0 +1,101 @@
+package fact
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/pkg/errors"
+)
+
+type CPU struct {
+	Count int    `cty:"count"`
+	Model string `cty:"model"`
+}
+
+// All sizes are in bytes.
+type Memory struct {
+	Total     int64 `cty:"total"`
+	Available int64 `cty:"available"`
+	SwapTotal int64 `cty:"swap_total"`
+	SwapFree  int64 `cty:"swap_free"`
+}
+
+func GatherCPUFacts() (*CPU, error) {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+
+	cpu := &CPU{}
+	for _, line := range stringx.SplitLines(string(data)) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "processor":
+			cpu.Count++
+		case "model name", "cpu model", "uarch":
+			if cpu.Model == "" {
+				cpu.Model = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	// Not every architecture lists its processors in /proc/cpuinfo.
+	if cpu.Count == 0 {
+		cpu.Count = runtime.NumCPU()
+	}
+
+	return cpu, nil
+}
+
+func GatherMemoryFacts() (*Memory, error) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	mem := &Memory{}
+	for _, line := range stringx.SplitLines(string(data)) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		var dst *int64
+		switch key {
+		case "MemTotal":
+			dst = &mem.Total
+		case "MemAvailable":
+			dst = &mem.Available
+		case "SwapTotal":
+			dst = &mem.SwapTotal
+		case "SwapFree":
+			dst = &mem.SwapFree
+		default:
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return nil, errors.Errorf("unparseable meminfo line: %s", line)
+		}
+
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(fields) > 1 && fields[1] == "kB" {
+			size *= 1024
+		}
+		*dst = size
+	}
+
+	return mem, nil
+}
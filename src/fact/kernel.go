@@ -0,0 +1,30 @@
+package fact
+
+import (
+	"os"
+	"strings"
+)
+
+type Kernel struct {
+	Name    string `cty:"name"`
+	Release string `cty:"release"`
+	Version string `cty:"version"`
+}
+
+func GatherKernelFacts() (*Kernel, error) {
+	kernel := &Kernel{}
+
+	for path, dst := range map[string]*string{
+		"/proc/sys/kernel/ostype":    &kernel.Name,
+		"/proc/sys/kernel/osrelease": &kernel.Release,
+		"/proc/sys/kernel/version":   &kernel.Version,
+	} {
+		data, err := os.ReadFile(path) // #nosec G304
+		if err != nil {
+			return nil, err
+		}
+		*dst = strings.TrimSpace(string(data))
+	}
+
+	return kernel, nil
+}
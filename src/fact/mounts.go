@@ -0,0 +1,57 @@
+package fact
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/pkg/errors"
+)
+
+type Mount struct {
+	Device     string   `cty:"device"`
+	Mountpoint string   `cty:"mountpoint"`
+	Type       string   `cty:"type"`
+	Options    []string `cty:"options"`
+}
+
+func GatherMountFacts() ([]*Mount, error) {
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := []*Mount{}
+	for _, line := range stringx.SplitLines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			return nil, errors.Errorf("unparseable mount line: %s", line)
+		}
+
+		mounts = append(mounts, &Mount{
+			Device:     unescapeMount(fields[0]),
+			Mountpoint: unescapeMount(fields[1]),
+			Type:       fields[2],
+			Options:    strings.Split(fields[3], ","),
+		})
+	}
+
+	return mounts, nil
+}
+
+// Whitespace and backslashes are octal-escaped by the kernel, e.g., `\040'.
+func unescapeMount(s string) string {
+	out := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				out.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
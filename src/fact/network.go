@@ -0,0 +1,139 @@
+package fact
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/stringx"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/cpu"
+)
+
+type Interface struct {
+	Name      string   `cty:"name"`
+	MAC       string   `cty:"mac"`
+	MTU       int      `cty:"mtu"`
+	Up        bool     `cty:"up"`
+	Loopback  bool     `cty:"loopback"`
+	Addresses []string `cty:"addresses"`
+}
+
+type Route struct {
+	Interface string `cty:"interface"`
+	Gateway   string `cty:"gateway"`
+}
+
+func GatherInterfaceFacts() ([]*Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*Interface{}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		addresses := []string{}
+		for _, addr := range addrs {
+			addresses = append(addresses, addr.String())
+		}
+
+		result = append(result, &Interface{
+			Name:      iface.Name,
+			MAC:       iface.HardwareAddr.String(),
+			MTU:       iface.MTU,
+			Up:        iface.Flags&net.FlagUp != 0,
+			Loopback:  iface.Flags&net.FlagLoopback != 0,
+			Addresses: addresses,
+		})
+	}
+
+	return result, nil
+}
+
+// GatherDefaultRoute returns the IPv4 default route from /proc/net/route, or
+// nil if there is none.
+func GatherDefaultRoute() (*Route, error) {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for i, line := range stringx.SplitLines(string(data)) {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 8 {
+			continue
+		}
+
+		if fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		// The gateway is an IPv4 address in network byte order that is
+		// printed as a hex-encoded integer in the native byte order.
+		n, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			return nil, errors.Errorf("unparseable route line: %s", line)
+		}
+
+		gw := make(net.IP, net.IPv4len)
+		if cpu.IsBigEndian {
+			binary.BigEndian.PutUint32(gw, uint32(n))
+		} else {
+			binary.LittleEndian.PutUint32(gw, uint32(n))
+		}
+
+		return &Route{
+			Interface: fields[0],
+			Gateway:   gw.String(),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// GatherDefaultRoute6 returns the IPv6 default route from /proc/net/ipv6_route,
+// or nil if there is none.
+func GatherDefaultRoute6() (*Route, error) {
+	data, err := os.ReadFile("/proc/net/ipv6_route")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	zero := strings.Repeat("0", 32)
+	for _, line := range stringx.SplitLines(string(data)) {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+
+		if fields[0] != zero || fields[1] != "00" || fields[9] == "lo" {
+			continue
+		}
+
+		gw, err := hex.DecodeString(fields[4])
+		if err != nil || len(gw) != net.IPv6len {
+			return nil, errors.Errorf("unparseable route line: %s", line)
+		}
+
+		return &Route{
+			Interface: fields[9],
+			Gateway:   net.IP(gw).String(),
+		}, nil
+	}
+
+	return nil, nil
+}
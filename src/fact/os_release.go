@@ -1,50 +1,125 @@
 package fact
 
 import (
+	"os"
 	"regexp"
+	"strings"
 
-	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/illikainen/go-utils/src/stringx"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// Per os-release(5), /usr/lib/os-release is used if /etc/os-release doesn't
+// exist.
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+var osReleaseRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+
 type OS struct {
-	Name     string `cty:"name"`
-	Version  string `cty:"version"`
-	Codename string `cty:"codename"`
+	Name       string   `cty:"name"`
+	IDLike     []string `cty:"id_like"`
+	Version    string   `cty:"version"`
+	Codename   string   `cty:"codename"`
+	PrettyName string   `cty:"pretty_name"`
 }
 
 func GatherOSFacts() (*OS, error) {
-	data, err := iofs.ReadFile("/etc/os-release")
-	if err != nil {
-		return nil, err
+	for _, path := range osReleasePaths {
+		data, err := os.ReadFile(path) // #nosec G304
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		return ParseOSRelease(path, string(data)), nil
 	}
 
-	osRelease := OS{}
+	return nil, errors.Errorf("no os-release file in %s", strings.Join(osReleasePaths, ", "))
+}
 
-	rx, err := regexp.Compile("(^[A-Z_]+)=\"?([^\"$]*)\"?$")
-	if err != nil {
-		return nil, err
-	}
+// ParseOSRelease parses the shell-compatible variable assignments in an
+// os-release file.  Lines that can't be parsed are skipped.
+func ParseOSRelease(path string, data string) *OS {
+	osRelease := &OS{IDLike: []string{}}
 
-	for _, line := range stringx.SplitLines(string(data)) {
-		match := rx.FindStringSubmatch(line)
+	for i, line := range stringx.SplitLines(data) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		match := osReleaseRegexp.FindStringSubmatch(line)
 		if match == nil {
-			return nil, errors.Errorf("unparseable os-release line: %s", line)
+			log.Warnf("%s:%d: skipping unparseable line: %s", path, i+1, line)
+			continue
+		}
+
+		value, err := unquoteOSReleaseValue(match[2])
+		if err != nil {
+			log.Warnf("%s:%d: %s", path, i+1, err)
+			continue
 		}
 
 		switch match[1] {
 		case "ID":
-			osRelease.Name = match[2]
+			osRelease.Name = value
+		case "ID_LIKE":
+			osRelease.IDLike = strings.Fields(value)
 		case "VERSION_ID":
-			osRelease.Version = match[2]
+			osRelease.Version = value
 		case "VERSION_CODENAME":
-			osRelease.Codename = match[2]
+			osRelease.Codename = value
+		case "PRETTY_NAME":
+			osRelease.PrettyName = value
+		default:
+			log.Tracef("skipping unknown os-release variable: %s", match[1])
+		}
+	}
+
+	if osRelease.Name == "" {
+		// ID defaults to "linux" per os-release(5).
+		osRelease.Name = "linux"
+	}
+	if osRelease.PrettyName == "" {
+		osRelease.PrettyName = "Linux"
+	}
+
+	return osRelease
+}
+
+// Values follow shell quoting rules: single quotes are literal, double quotes
+// allow \", \\, \$ and \` escapes and a backslash outside of quotes escapes
+// the next character.
+func unquoteOSReleaseValue(raw string) (string, error) {
+	value := strings.Builder{}
+	quote := rune(0)
+	escaped := false
+
+	for _, c := range raw {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`\n", c) {
+				value.WriteRune('\\')
+			}
+			value.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == quote:
+			quote = 0
 		default:
-			log.Debugf("skipping unknown os-release line: %s", line)
+			value.WriteRune(c)
 		}
 	}
 
-	return &osRelease, nil
+	if quote != 0 || escaped {
+		return "", errors.Errorf("unterminated value: %s", raw)
+	}
+
+	return value.String(), nil
 }
@@ -0,0 +1,82 @@
+package fact
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/illikainen/go-utils/src/iofs"
+)
+
+// GatherVirtualizationFacts makes a best-effort guess at the container or
+// hypervisor the host is running in.  Containers take precedence over
+// hypervisors and "none" is returned for bare-metal hosts.
+func GatherVirtualizationFacts() string {
+	if exists, _ := iofs.Exists("/.dockerenv"); exists {
+		return "docker"
+	}
+
+	if exists, _ := iofs.Exists("/run/.containerenv"); exists {
+		return "podman"
+	}
+
+	if container := readFact("/run/systemd/container"); container != "" {
+		return container
+	}
+
+	if environ, err := os.ReadFile("/proc/1/environ"); err == nil {
+		for _, env := range bytes.Split(environ, []byte{0}) {
+			prefix := []byte("container=")
+			if bytes.HasPrefix(env, prefix) && len(env) > len(prefix) {
+				return string(env[len(prefix):])
+			}
+		}
+	}
+
+	if vz, _ := iofs.Exists("/proc/vz"); vz {
+		if bc, _ := iofs.Exists("/proc/bc"); !bc {
+			return "openvz"
+		}
+	}
+
+	if readFact("/sys/hypervisor/type") == "xen" {
+		return "xen"
+	}
+
+	vendor := readFact("/sys/class/dmi/id/sys_vendor")
+	product := readFact("/sys/class/dmi/id/product_name")
+	switch {
+	case strings.Contains(product, "KVM"):
+		return "kvm"
+	case strings.Contains(vendor, "QEMU"):
+		return "qemu"
+	case strings.Contains(vendor, "VMware"):
+		return "vmware"
+	case strings.Contains(vendor, "innotek") || strings.Contains(product, "VirtualBox"):
+		return "oracle"
+	case strings.Contains(vendor, "Microsoft") && strings.Contains(product, "Virtual Machine"):
+		return "microsoft"
+	case strings.Contains(vendor, "Amazon EC2"):
+		return "amazon"
+	case strings.Contains(vendor, "Google"):
+		return "google"
+	case strings.Contains(vendor, "Xen"):
+		return "xen"
+	}
+
+	if cpuinfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		if bytes.Contains(cpuinfo, []byte(" hypervisor")) {
+			return "vm-other"
+		}
+	}
+
+	return "none"
+}
+
+func readFact(path string) string {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
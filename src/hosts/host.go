@@ -5,6 +5,7 @@ import (
 	"github.com/illikainen/orch/src/hosts/qvm"
 	"github.com/illikainen/orch/src/hosts/ssh"
 	"github.com/illikainen/orch/src/rpc/controller"
+	"github.com/illikainen/orch/src/tasks/outputs"
 
 	"github.com/hashicorp/hcl/v2"
 	"github.com/pkg/errors"
@@ -31,6 +32,7 @@ type Host struct {
 	Tags         []string `hcl:"tags,optional"`
 	Body         hcl.Body `hcl:"body,remain"`
 	Dependencies []string
+	References   []*outputs.Reference
 	Connector    Connector
 }
 
@@ -41,13 +43,10 @@ func (h *Host) PartialDecode() error {
 	}
 
 	for _, attr := range attrs {
-		for _, v := range attr.Expr.Variables() {
-			if len(v) >= 2 {
-				if root, ok := v[0].(hcl.TraverseRoot); ok && root.Name == "out" {
-					if host, ok := v[1].(hcl.TraverseAttr); ok && host.Name != "this" {
-						h.Dependencies = append(h.Dependencies, host.Name)
-					}
-				}
+		for _, ref := range outputs.References(attr.Expr) {
+			h.References = append(h.References, ref)
+			if ref.Host != "this" {
+				h.Dependencies = append(h.Dependencies, ref.Host)
 			}
 		}
 	}
@@ -55,8 +54,8 @@ func (h *Host) PartialDecode() error {
 	return h.Validate()
 }
 
-func (h *Host) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
-	ctx, err := ctxfn()
+func (h *Host) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
+	ctx, err := ctxfn(h.Body)
 	if err != nil {
 		return err
 	}
@@ -75,6 +74,15 @@ func (h *Host) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
 	return connector.Validate()
 }
 
+// Functions returns the functions of the connector without decoding it.
+func (h *Host) Functions() (map[string]function.Function, error) {
+	connector, err := h.getConnector()
+	if err != nil {
+		return nil, err
+	}
+	return connector.Functions(), nil
+}
+
 func (h *Host) Validate() error {
 	if h.Name == "this" {
 		return errors.Errorf("`this' is a reserved name")
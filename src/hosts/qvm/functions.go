@@ -0,0 +1,42 @@
+package qvm
+
+import (
+	"strings"
+
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+func (h *Host) Functions() map[string]function.Function {
+	return map[string]function.Function{
+		"exec": h.exec(),
+	}
+}
+
+func (h *Host) exec() function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{
+				Name: "cmd",
+				Type: cty.String,
+			},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			// qvm-run-vm joins its arguments into a single command line,
+			// so the command is quoted to keep it intact.
+			out, err := Exec(&ExecOptions{
+				Name:    h.Hostname,
+				Command: []string{"/bin/sh", "-c", utils.ShellQuote(args[0].AsString())},
+				Become:  h.Become,
+			})
+			if err != nil {
+				return cty.StringVal(""), err
+			}
+
+			return cty.StringVal(strings.Trim(string(out.Stdout), "\r\n")), nil
+		},
+	})
+}
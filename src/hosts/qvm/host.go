@@ -21,7 +21,6 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
-	"github.com/zclconf/go-cty/cty/function"
 )
 
 type Host struct {
@@ -119,14 +118,9 @@ func (h *Host) getSysInfo() (*sysinfo, error) {
 		return nil, err
 	}
 
-	elts := strings.Split(strings.TrimRight(string(uname.Stdout), "\n"), " ")
-	if len(elts) != 2 {
-		return nil, errors.Errorf("invalid output: %s", uname.Stdout)
-	}
-
-	arch := elts[1]
-	if arch == "x86_64" {
-		arch = "amd64"
+	goos, goarch, err := utils.ParseUname(string(uname.Stdout))
+	if err != nil {
+		return nil, err
 	}
 
 	printenv, err := Exec(&ExecOptions{
@@ -140,8 +134,8 @@ func (h *Host) getSysInfo() (*sysinfo, error) {
 	home := strings.TrimRight(string(printenv.Stdout), "\n")
 
 	return &sysinfo{
-		os:   strings.ToLower(elts[0]),
-		arch: arch,
+		os:   goos,
+		arch: goarch,
 		home: home,
 	}, nil
 }
@@ -268,7 +262,3 @@ func (h *Host) Close() error {
 
 	return nil
 }
-
-func (h *Host) Functions() map[string]function.Function {
-	return nil
-}
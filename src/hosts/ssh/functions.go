@@ -3,6 +3,8 @@ package ssh
 import (
 	"strings"
 
+	"github.com/illikainen/orch/src/utils"
+
 	"github.com/illikainen/go-netutils/src/sshx"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/function"
@@ -23,8 +25,17 @@ func (h *Host) exec() function.Function {
 		},
 		Type: function.StaticReturnType(cty.String),
 		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			// The command is wrapped in a shell if we need to become
+			// another user so that the whole command is executed as
+			// that user and not only the first pipeline element.
+			cmd := args[0].AsString()
+			if h.Become != "" {
+				cmd = "sh -c " + utils.ShellQuote(cmd)
+			}
+
 			out, err := h.conn.Exec(&sshx.ExecOptions{
-				Command: args[0].AsString(),
+				Command: cmd,
+				Become:  h.Become,
 			})
 			if err != nil {
 				return cty.StringVal(""), err
@@ -83,6 +83,15 @@ func (h *Host) Decode(name string, body hcl.Body, ctx *hcl.EvalContext) error {
 		h.Hostname = name
 	}
 
+	// The password is marked so that it's redacted if it's referenced
+	// elsewhere in the blueprint.
+	if h.Password != "" {
+		utils.RegisterSecret(h.Password)
+		attrs := value.AsValueMap()
+		attrs["password"] = utils.MarkSensitive(attrs["password"])
+		value = cty.ObjectVal(attrs)
+	}
+
 	h.value = value
 
 	return nil
@@ -140,14 +149,9 @@ func (h *Host) getSysInfo() (*sysinfo, error) {
 		return nil, err
 	}
 
-	elts := strings.Split(strings.TrimRight(string(uname.Stdout), "\n"), " ")
-	if len(elts) != 2 {
-		return nil, errors.Errorf("invalid output: %s", uname.Stdout)
-	}
-
-	arch := elts[1]
-	if arch == "x86_64" {
-		arch = "amd64"
+	goos, goarch, err := utils.ParseUname(string(uname.Stdout))
+	if err != nil {
+		return nil, err
 	}
 
 	printenv, err := h.conn.Exec(&sshx.ExecOptions{
@@ -160,8 +164,8 @@ func (h *Host) getSysInfo() (*sysinfo, error) {
 	home := strings.TrimRight(string(printenv.Stdout), "\n")
 
 	return &sysinfo{
-		os:   strings.ToLower(elts[0]),
-		arch: arch,
+		os:   goos,
+		arch: goarch,
 		home: home,
 	}, nil
 }
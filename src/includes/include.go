@@ -21,6 +21,6 @@ func (i *Include) PartialDecode(basedir string) error {
 	return nil
 }
 
-func (i *Include) Decode(_ func() (*hcl.EvalContext, error)) error {
+func (i *Include) Decode(_ func(hcl.Body) (*hcl.EvalContext, error)) error {
 	return nil
 }
@@ -16,7 +16,7 @@ func (i *Includes) PartialDecode(basedir string) error {
 	return nil
 }
 
-func (i *Includes) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
+func (i *Includes) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
 	for _, include := range *i {
 		err := include.Decode(ctxfn)
 		if err != nil {
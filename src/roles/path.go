@@ -0,0 +1,52 @@
+package roles
+
+import (
+	"os"
+	"strings"
+
+	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/pkg/errors"
+)
+
+// Path resolves the roles in bindings and role dependencies to directories.
+// The config provides the keyring for sealed files in the roles.
+type Path struct {
+	Basedir string
+	Dirs    []string
+	Sources map[string]string
+	Config  *configs.Config
+}
+
+// Lookup finds a role.  Names prefixed by `<source>:' refer to a role in a
+// role source.  Other names are relative to the blueprint, falling back to
+// every directory in the role path in order.
+func (p *Path) Lookup(name string) (string, error) {
+	if src, sub, ok := strings.Cut(name, ":"); ok {
+		dir, ok := p.Sources[src]
+		if !ok {
+			return "", errors.Errorf("%s: unknown role source \"%s\"", name, src)
+		}
+		return utils.JoinCtyPath(dir, sub)
+	}
+
+	dir, err := utils.JoinCtyPath(p.Basedir, name)
+	if err != nil || len(p.Dirs) == 0 {
+		return dir, err
+	}
+
+	for _, base := range append([]string{p.Basedir}, p.Dirs...) {
+		path, err := utils.JoinCtyPath(base, name)
+		if err != nil {
+			return "", err
+		}
+
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			return path, nil
+		}
+	}
+
+	return "", errors.Errorf("role %s not found in %s or the role path (%s)",
+		name, p.Basedir, strings.Join(p.Dirs, ", "))
+}
@@ -1,11 +1,16 @@
 package roles
 
 import (
+	"fmt"
 	"io/fs"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/seal"
 	"github.com/illikainen/orch/src/tasks"
+	"github.com/illikainen/orch/src/tasks/outputs"
 	"github.com/illikainen/orch/src/variables"
 
 	"github.com/hashicorp/hcl/v2"
@@ -15,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
 type Role struct {
@@ -23,10 +29,34 @@ type Role struct {
 	RelativeDir  string
 	Tasks        tasks.Tasks         `hcl:"task,block"`
 	Variables    variables.Variables `hcl:"var,block"`
+	Defaults     []*Defaults         `hcl:"defaults,block"`
+	Meta         *Meta               `hcl:"meta,block"`
 	Dependencies []string
+	References   []*outputs.Reference
+	Vars         map[string]cty.Value
+	VarsRange    hcl.Range
+	defaults     map[string]*hcl.Attribute
+	defaultsBody map[string]hcl.Body
+	params       cty.Value
 }
 
-func (r *Role) PartialDecode() error {
+// Meta describes the role itself.  DependsOn lists the roles that must be
+// applied before this one, relative to the blueprint like the roles in a
+// binding.  Tags apply to every task in the role.
+type Meta struct {
+	DependsOn []string `hcl:"depends_on,optional"`
+	Tags      []string `hcl:"tags,optional"`
+}
+
+// Defaults declare the parameters of a role.  They're overridden by the
+// `vars' of the binding that includes the role.
+type Defaults struct {
+	Body hcl.Body `hcl:"body,remain"`
+}
+
+// PartialDecode parses every HCL file in the role directory.  Sealed files
+// are unsealed with the keyring of the config.
+func (r *Role) PartialDecode(config *configs.Config) error {
 	err := filepath.WalkDir(r.Dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -36,11 +66,17 @@ func (r *Role) PartialDecode() error {
 			return nil
 		}
 
-		if strings.ToLower(filepath.Ext(path)) == ".hcl" {
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == ".hcl" || ext == ".hclseal" {
 			log.Debugf("decoding %s", path)
 
+			data, _, err := seal.ReadSource(path, config)
+			if err != nil {
+				return err
+			}
+
 			hcl := hclparse.NewParser()
-			hclFile, diags := hcl.ParseHCLFile(path)
+			hclFile, diags := hcl.ParseHCL(data, path)
 			if diags != nil {
 				return diags
 			}
@@ -53,6 +89,14 @@ func (r *Role) PartialDecode() error {
 
 			r.Variables = append(r.Variables, role.Variables...)
 			r.Tasks = append(r.Tasks, role.Tasks...)
+			r.Defaults = append(r.Defaults, role.Defaults...)
+
+			if role.Meta != nil {
+				if r.Meta != nil {
+					return errors.Errorf("%s: role \"%s\" has more than one meta block", path, r.Name)
+				}
+				r.Meta = role.Meta
+			}
 		}
 		return nil
 	})
@@ -60,6 +104,24 @@ func (r *Role) PartialDecode() error {
 		return err
 	}
 
+	r.defaults = map[string]*hcl.Attribute{}
+	r.defaultsBody = map[string]hcl.Body{}
+	for _, defaults := range r.Defaults {
+		attrs, diags := defaults.Body.JustAttributes()
+		if diags.HasErrors() {
+			return diags
+		}
+
+		for name, attr := range attrs {
+			if prev, ok := r.defaults[name]; ok {
+				return errors.Errorf("%s: default \"%s\" is already declared at %s",
+					attr.Range, name, prev.Range)
+			}
+			r.defaults[name] = attr
+			r.defaultsBody[name] = defaults.Body
+		}
+	}
+
 	err = r.Variables.PartialDecode()
 	if err != nil {
 		return err
@@ -70,13 +132,70 @@ func (r *Role) PartialDecode() error {
 		return err
 	}
 
-	r.Dependencies = append(r.Variables.Dependencies(), r.Tasks.Dependencies()...)
+	// The defaults and variables are evaluated when the binding is decoded,
+	// before any task of the role, so their references are collected for
+	// the role rather than for a task.
+	names := []string{}
+	for name := range r.defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deps := []string{}
+	for _, name := range names {
+		for _, ref := range outputs.References(r.defaults[name].Expr) {
+			r.References = append(r.References, ref)
+			if ref.Host != "this" {
+				deps = append(deps, ref.Host)
+			}
+		}
+	}
+	r.References = append(r.References, r.Variables.References()...)
+
+	r.Dependencies = append(append(deps, r.Variables.Dependencies()...), r.Tasks.Dependencies()...)
 
 	return r.Validate()
 }
 
-func (r *Role) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
-	err := r.Variables.Decode(ctxfn)
+// Decode evaluates the parameters of the role before its variables so that
+// the variables can refer to them.  Defaults are evaluated in the context of
+// the blueprint and overridden by the vars of the binding, which must have
+// the type of the default.
+func (r *Role) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
+	params := map[string]cty.Value{}
+	for name, attr := range r.defaults {
+		ctx, err := ctxfn(r.defaultsBody[name])
+		if err != nil {
+			return err
+		}
+
+		value, diags := attr.Expr.Value(ctx)
+
+		if v, ok := r.Vars[name]; ok {
+			// Defaults that can't be evaluated have no type to
+			// check against.
+			if !diags.HasErrors() && !compatibleTypes(v, value) {
+				return hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid type for role variable",
+					Detail: fmt.Sprintf("The var \"%s\" of role %s must be of type %s like its default, "+
+						"not %s.", name, r.Name, value.Type().FriendlyName(),
+						v.Type().FriendlyName()),
+					Subject: r.VarsRange.Ptr(),
+				}}
+			}
+			params[name] = v
+			continue
+		}
+
+		if diags.HasErrors() {
+			return diags
+		}
+		params[name] = value
+	}
+	r.params = cty.ObjectVal(params)
+
+	err := r.Variables.Decode(r.EvalContext(ctxfn))
 	if err != nil {
 		return err
 	}
@@ -84,6 +203,91 @@ func (r *Role) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
 	return nil
 }
 
+// EvalContext wraps a context function so that expressions in the role see
+// its parameters as `param' and this instance of the role as `role.<name>',
+// even if the same role is included by several bindings.
+func (r *Role) EvalContext(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) func(hcl.Body) (*hcl.EvalContext,
+	error) {
+	return func(body hcl.Body) (*hcl.EvalContext, error) {
+		ctx, err := ctxfn(body)
+		if err != nil {
+			return nil, err
+		}
+
+		vars := map[string]cty.Value{}
+		for name, value := range ctx.Variables {
+			vars[name] = value
+		}
+
+		roles := map[string]cty.Value{}
+		if value, ok := vars["role"]; ok && value.CanIterateElements() {
+			roles = value.AsValueMap()
+		}
+		roles[r.Name] = r.Value()
+		vars["role"] = cty.ObjectVal(roles)
+
+		if r.params != cty.NilVal {
+			vars["param"] = r.params
+		}
+
+		ctx.Variables = vars
+		return ctx, nil
+	}
+}
+
+// compatibleTypes checks whether a var may override a default.  Primitive
+// vars must be convertible to the type of the default, while collections
+// only need to be of the same kind since a default such as `[]' or `{}'
+// doesn't say anything about the type of its elements.
+func compatibleTypes(v cty.Value, dflt cty.Value) bool {
+	v, _ = v.UnmarkDeep()
+	dflt, _ = dflt.UnmarkDeep()
+
+	vty, dty := v.Type(), dflt.Type()
+	if v.IsNull() || dflt.IsNull() || vty == cty.DynamicPseudoType || dty == cty.DynamicPseudoType {
+		return true
+	}
+
+	switch {
+	case dty.IsPrimitiveType():
+		_, err := convert.Convert(v, dty)
+		return err == nil
+	case dty.IsObjectType() || dty.IsMapType():
+		return vty.IsObjectType() || vty.IsMapType()
+	case dty.IsListType() || dty.IsSetType() || dty.IsTupleType():
+		return vty.IsListType() || vty.IsSetType() || vty.IsTupleType()
+	}
+	return true
+}
+
+// HasDefault checks whether the role declares a parameter.
+func (r *Role) HasDefault(name string) bool {
+	_, ok := r.defaults[name]
+	return ok
+}
+
+// HasDefaults checks whether the role declares any parameters.
+func (r *Role) HasDefaults() bool {
+	return len(r.defaults) > 0
+}
+
+// DependsOn returns the roles that this role depends on.
+func (r *Role) DependsOn() []string {
+	if r.Meta == nil {
+		return nil
+	}
+	return r.Meta.DependsOn
+}
+
+// TaskTags returns the tags of a task, including the tags of the role.
+func (r *Role) TaskTags(task *tasks.Task) []string {
+	tags := task.Tags
+	if r.Meta != nil {
+		tags = append(append([]string{}, r.Meta.Tags...), tags...)
+	}
+	return seq.Uniq(tags)
+}
+
 func (r *Role) Value() cty.Value {
 	value := map[string]cty.Value{}
 	for _, task := range r.Tasks {
@@ -99,7 +303,10 @@ func (r *Role) Unique() string {
 	return r.Name
 }
 
+// Validate reports every task and variable whose name is already taken in
+// the role.
 func (r *Role) Validate() error {
+	var diags hcl.Diagnostics
 	seen := []string{"condition", "task", "name"}
 
 	for _, task := range r.Tasks {
@@ -109,7 +316,7 @@ func (r *Role) Validate() error {
 		}
 
 		if seq.Contains(seen, task.Unique()) {
-			return errors.Errorf("task \"%s\" is not unique", task.Unique())
+			diags = append(diags, r.duplicateDiagnostic(task.Unique(), task.Body))
 		}
 		seen = append(seen, task.Unique())
 	}
@@ -121,10 +328,22 @@ func (r *Role) Validate() error {
 		}
 
 		if seq.Contains(seen, v.Unique()) {
-			return errors.Errorf("task \"%s\" is not unique", v.Unique())
+			diags = append(diags, r.duplicateDiagnostic(v.Unique(), v.Body))
 		}
 		seen = append(seen, v.Unique())
 	}
 
+	if diags.HasErrors() {
+		return diags
+	}
 	return nil
 }
+
+func (r *Role) duplicateDiagnostic(name string, body hcl.Body) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Duplicate task",
+		Detail:   fmt.Sprintf("The role \"%s\" already has a task or variable named \"%s\".", r.Name, name),
+		Subject:  body.MissingItemRange().Ptr(),
+	}
+}
@@ -1,6 +1,9 @@
 package roles
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/illikainen/go-utils/src/seq"
 	"github.com/pkg/errors"
@@ -8,17 +11,86 @@ import (
 
 type Roles []*Role
 
-func (r *Roles) PartialDecode() error {
+// PartialDecode decodes the roles and the roles they depend on.  Shared
+// dependencies are only included once, and the roles are ordered so that
+// every role comes after the roles it depends on.  Roles that are shared
+// between bindings are deduplicated for each host by Bindings.Match().
+func (r *Roles) PartialDecode(path *Path) error {
+	decoded := map[string]*Role{}
+	resolved := Roles{}
+	visiting := Roles{}
+
+	var visit func(role *Role) error
+	visit = func(role *Role) error {
+		for i, elt := range visiting {
+			if elt.Dir == role.Dir {
+				cycle := []string{}
+				for _, e := range visiting[i:] {
+					cycle = append(cycle, e.Name)
+				}
+				return errors.Errorf("circular role dependency: %s -> %s",
+					strings.Join(cycle, " -> "), role.Name)
+			}
+		}
+
+		if seq.ContainsBy(resolved, func(e *Role) bool { return e.Dir == role.Dir }) {
+			return nil
+		}
+
+		visiting = append(visiting, role)
+		for _, dep := range role.DependsOn() {
+			dir, err := path.Lookup(dep)
+			if err != nil {
+				return errors.Wrap(err, role.Name)
+			}
+
+			depRole, ok := decoded[dir]
+			if !ok {
+				depRole = &Role{
+					Name: filepath.Base(dir),
+					Dir:  dir,
+				}
+
+				err := depRole.PartialDecode(path.Config)
+				if err != nil {
+					return err
+				}
+				decoded[dir] = depRole
+			}
+
+			err = visit(depRole)
+			if err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		resolved = append(resolved, role)
+		return nil
+	}
+
 	for _, role := range *r {
-		err := role.PartialDecode()
+		if _, ok := decoded[role.Dir]; ok {
+			continue
+		}
+
+		err := role.PartialDecode(path.Config)
+		if err != nil {
+			return err
+		}
+		decoded[role.Dir] = role
+
+		err = visit(role)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+
+	*r = resolved
+	return r.Validate()
 }
 
-func (r *Roles) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
+func (r *Roles) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
 	for _, role := range *r {
 		if err := role.Decode(ctxfn); err != nil {
 			return err
@@ -0,0 +1,366 @@
+package roles
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/metadata"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/illikainen/go-utils/src/process"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Lock records the resolved commit and the hash of every role source so that
+// a blueprint is applied with the same roles until the lock is updated.
+type Lock struct {
+	Sources map[string]*LockedSource `json:"sources"`
+}
+
+type LockedSource struct {
+	Git    string `json:"git,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Hash   string `json:"hash"`
+}
+
+// LockPath returns the lock file for a blueprint or a configuration.
+func LockPath(path string) string {
+	return strings.TrimRight(path, string(os.PathSeparator)) + ".lock"
+}
+
+// CacheDir is where git sources are checked out.
+func CacheDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cache, metadata.Name(), "roles"), nil
+}
+
+// FetchSources checks out every role source and updates the lock file.  Git
+// sources are checked out into the cache at the commit in the lock file, or
+// at their ref if they aren't locked yet.  It's an error if the content of a
+// locked source has changed.
+func FetchSources(sources map[string]*configs.RoleSource, lockPath string) error {
+	prev, err := readLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	if len(sources) == 0 && len(prev.Sources) == 0 {
+		return nil
+	}
+
+	_, lock, err := resolveSources(sources, lockPath, true)
+	if err != nil {
+		return err
+	}
+
+	return writeLock(lockPath, lock)
+}
+
+// ResolveSources resolves every role source to a directory without fetching
+// anything or writing the lock file.  Every source must have been fetched
+// with FetchSources() and its content must match the lock file.
+func ResolveSources(sources map[string]*configs.RoleSource, lockPath string) (map[string]string, error) {
+	dirs, _, err := resolveSources(sources, lockPath, false)
+	return dirs, err
+}
+
+func resolveSources(sources map[string]*configs.RoleSource, lockPath string, fetch bool) (
+	map[string]string, *Lock, error) {
+	lock, err := readLock(lockPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{}
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dirs := map[string]string{}
+	locked := map[string]*LockedSource{}
+	for _, name := range names {
+		src := sources[name]
+
+		prev, ok := lock.Sources[name]
+		if ok && (prev.Git != src.Git || prev.Ref != src.Ref || prev.Path != src.Path) {
+			if !fetch {
+				return nil, nil, errors.Errorf("role source %s has changed since it was locked in %s; "+
+					"run `%s fetch` to update it", name, lockPath, metadata.Name())
+			}
+			log.Infof("role source %s changed; updating %s", name, lockPath)
+			prev = nil
+		}
+
+		if prev == nil && !fetch {
+			return nil, nil, errors.Errorf("role source %s is not locked in %s; run `%s fetch` to lock it",
+				name, lockPath, metadata.Name())
+		}
+
+		cur := &LockedSource{
+			Git:  src.Git,
+			Ref:  src.Ref,
+			Path: src.Path,
+		}
+
+		dir := src.Path
+		if src.Git != "" {
+			if prev != nil {
+				cur.Commit = prev.Commit
+			}
+
+			if fetch {
+				dir, cur.Commit, err = checkoutSource(src, cur.Commit)
+			} else {
+				dir, err = lockedCheckout(src, cur.Commit)
+			}
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "role source %s", name)
+			}
+		}
+
+		cur.Hash, err = hashDir(dir)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "role source %s", name)
+		}
+
+		if prev != nil && prev.Hash != cur.Hash {
+			return nil, nil, errors.Errorf("role source %s: %s has changed since it was locked "+
+				"(sha256=%s, locked sha256=%s); remove it from %s to accept the changes",
+				name, dir, cur.Hash, prev.Hash, lockPath)
+		}
+
+		log.Debugf("role source %s: %s (sha256=%s)", name, dir, cur.Hash)
+		dirs[name] = dir
+		locked[name] = cur
+	}
+
+	return dirs, &Lock{Sources: locked}, nil
+}
+
+func readLock(path string) (*Lock, error) {
+	lock := &Lock{Sources: map[string]*LockedSource{}}
+
+	data, err := iofs.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return lock, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, lock)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	if lock.Sources == nil {
+		lock.Sources = map[string]*LockedSource{}
+	}
+	return lock, nil
+}
+
+// The lock file is only written if it changed.
+func writeLock(path string, lock *Lock) (err error) {
+	data, err := json.MarshalIndent(lock, "", "    ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	prev, err := iofs.ReadFile(path)
+	if err == nil && bytes.Equal(prev, data) {
+		return nil
+	}
+
+	err = utils.WriteData(path, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("wrote %s", path)
+	return nil
+}
+
+// Every commit of a repository is checked out into its own directory in the
+// cache next to a bare clone of the repository.  The repository is only
+// fetched if the commit isn't checked out already.
+func checkoutSource(src *configs.RoleSource, commit string) (string, string, error) {
+	cache, err := CacheDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(cache, repoID(src.Git))
+	repo := filepath.Join(base, "repo")
+
+	if commit != "" {
+		dir := filepath.Join(base, commit)
+		if ok, err := iofs.Exists(dir); err != nil || ok {
+			return dir, commit, err
+		}
+	}
+
+	err = fetchRepo(src.Git, repo)
+	if err != nil {
+		return "", "", err
+	}
+
+	if commit == "" {
+		out, err := git("-C", repo, "rev-parse", "--verify", "--end-of-options", src.Ref+"^{commit}")
+		if err != nil {
+			return "", "", errors.Wrapf(err, "invalid ref %s", src.Ref)
+		}
+		commit = out
+		log.Infof("%s: resolved %s to %s", src.Git, src.Ref, commit)
+	}
+
+	dir := filepath.Join(base, commit)
+	if ok, err := iofs.Exists(dir); err != nil || ok {
+		return dir, commit, err
+	}
+
+	tmp, err := os.MkdirTemp(base, commit+".*.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	_, err = git("clone", "--quiet", "--shared", "--no-checkout", "--", repo, tmp)
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = git("-C", tmp, "checkout", "--quiet", "--detach", commit)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = os.RemoveAll(filepath.Join(tmp, ".git"))
+	if err != nil {
+		return "", "", err
+	}
+
+	return dir, commit, os.Rename(tmp, dir)
+}
+
+// lockedCheckout returns the checkout of a locked commit without fetching
+// it.
+func lockedCheckout(src *configs.RoleSource, commit string) (string, error) {
+	cache, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(cache, repoID(src.Git), commit)
+	ok, err := iofs.Exists(dir)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.Errorf("%s is not checked out; run `%s fetch` to fetch it", commit, metadata.Name())
+	}
+	return dir, nil
+}
+
+func repoID(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func fetchRepo(url string, repo string) error {
+	ok, err := iofs.Exists(repo)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.Infof("cloning %s", url)
+		err := os.MkdirAll(filepath.Dir(repo), 0700)
+		if err != nil {
+			return err
+		}
+
+		_, err = git("clone", "--quiet", "--bare", "--", url, repo)
+		return err
+	}
+
+	log.Infof("fetching %s", url)
+	_, err = git("-C", repo, "fetch", "--quiet", "--force", "--tags", "origin",
+		"+refs/heads/*:refs/heads/*")
+	return err
+}
+
+func git(args ...string) (string, error) {
+	out, err := process.Exec(&process.ExecOptions{
+		Command: append([]string{"git"}, args...),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
+
+// The hash covers the relative path and content of every regular file.
+func hashDir(dir string) (string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	hsh := sha256.New()
+	for _, file := range files {
+		data, err := iofs.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = fmt.Fprintf(hsh, "%s\x00%d\x00", filepath.ToSlash(rel), len(data))
+		if err != nil {
+			return "", err
+		}
+
+		_, err = hsh.Write(data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hsh.Sum(nil)), nil
+}
@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+)
+
+// Audit is attached to function calls that should be recorded on the managed
+// host if they result in any changes.
+type Audit struct {
+	Log        string
+	Controller string
+	Role       string
+	Name       string
+}
+
+// Identity returns a description of the user running the controller.
+func Identity() (string, error) {
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s@%s", usr.Username, host), nil
+}
@@ -30,6 +30,7 @@ type FunctionCall struct {
 	Type     int
 	Function string
 	Params   any
+	Audit    *Audit
 }
 
 type Log struct {
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/illikainen/orch/src/metadata"
+	"github.com/illikainen/orch/src/rpc"
+
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const journald = "journald"
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// Changer is implemented by the return value of executors that are able to
+// modify the managed host.
+type Changer interface {
+	IsChanged() bool
+	Differences() map[string][]string
+}
+
+type AuditEntry struct {
+	Time       time.Time      `json:"time"`
+	Controller string         `json:"controller"`
+	Type       string         `json:"type"`
+	Role       string         `json:"role"`
+	Name       string         `json:"name"`
+	Changes    map[string]int `json:"changes"`
+}
+
+// checkAudit makes sure that an audit entry can be written before the
+// executor is allowed to change anything.
+func checkAudit(fc *rpc.FunctionCall) (err error) {
+	if fc.Audit == nil || fc.Audit.Log == "" {
+		return nil
+	}
+
+	if fc.Audit.Log == journald {
+		_, err := os.Stat(journaldSocket)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(fc.Audit.Log), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fc.Audit.Log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// The entry only summarizes the number of changes of each type to avoid
+// leaking file content into the audit log.
+func audit(fc *rpc.FunctionCall, rv any) error {
+	if fc.Audit == nil || fc.Audit.Log == "" {
+		return nil
+	}
+
+	changer, ok := rv.(Changer)
+	if !ok || !changer.IsChanged() {
+		return nil
+	}
+
+	entry := &AuditEntry{
+		Time:       time.Now().UTC(),
+		Controller: fc.Audit.Controller,
+		Type:       fc.Function,
+		Role:       fc.Audit.Role,
+		Name:       fc.Audit.Name,
+		Changes:    map[string]int{},
+	}
+	for typ, diff := range changer.Differences() {
+		if len(diff) > 0 {
+			entry.Changes[typ] = len(diff)
+		}
+	}
+
+	if fc.Audit.Log == journald {
+		return auditJournald(entry)
+	}
+	return auditFile(fc.Audit.Log, entry)
+}
+
+func auditFile(path string, entry *AuditEntry) (err error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer errorx.Defer(f.Close, &err)
+
+	n, err := f.Write(data)
+	if err != nil {
+		return err
+	}
+	if n != len(data) {
+		return errors.Errorf("invalid write size")
+	}
+
+	log.Debugf("audit: wrote %s.%s to %s", entry.Role, entry.Name, path)
+	return nil
+}
+
+// See <https://systemd.io/JOURNAL_NATIVE_PROTOCOL/>.
+func auditJournald(entry *AuditEntry) (err error) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	fields := [][2]string{
+		{"MESSAGE", fmt.Sprintf("%s changed %s.%s (%s)", entry.Controller, entry.Role, entry.Name,
+			entry.Type)},
+		{"PRIORITY", "5"},
+		{"SYSLOG_IDENTIFIER", metadata.Name()},
+		{"ORCH_CONTROLLER", entry.Controller},
+		{"ORCH_TASK_TYPE", entry.Type},
+		{"ORCH_ROLE", entry.Role},
+		{"ORCH_TASK", entry.Name},
+		{"ORCH_CHANGES", string(changes)},
+	}
+
+	buf := bytes.Buffer{}
+	for _, field := range fields {
+		if strings.Contains(field[1], "\n") {
+			buf.WriteString(field[0] + "\n")
+			err := binary.Write(&buf, binary.LittleEndian, uint64(len(field[1])))
+			if err != nil {
+				return err
+			}
+			buf.WriteString(field[1] + "\n")
+		} else {
+			buf.WriteString(field[0] + "=" + field[1] + "\n")
+		}
+	}
+
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return err
+	}
+	defer errorx.Defer(conn.Close, &err)
+
+	n, err := conn.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if n != buf.Len() {
+		return errors.Errorf("invalid write size")
+	}
+
+	log.Debugf("audit: wrote %s.%s to journald", entry.Role, entry.Name)
+	return nil
+}
@@ -57,7 +57,7 @@ func (w *Worker) Start() error {
 			if err != nil {
 				return errors.WithStack(err)
 			}
-			log.Tracef("message: %s", data)
+			log.Tracef("message: type %d", msg.Type)
 
 			switch msg.Type {
 			case rpc.ControlType:
@@ -133,6 +133,17 @@ func (w *Worker) Start() error {
 					continue
 				}
 
+				err = checkAudit(&fc)
+				if err != nil {
+					e := w.Return(&rpc.Return{
+						Error: errors.Wrap(err, "audit"),
+					})
+					if e != nil {
+						return e
+					}
+					continue
+				}
+
 				rv, err := executor.Execute()
 				if err != nil {
 					e := w.Return(&rpc.Return{
@@ -144,6 +155,13 @@ func (w *Worker) Start() error {
 					continue
 				}
 
+				// The change is already made at this point, so a failure
+				// to record it is logged rather than failing the task.
+				err = audit(&fc, rv)
+				if err != nil {
+					log.Errorf("audit: %s.%s: %v", fc.Audit.Role, fc.Audit.Name, err)
+				}
+
 				data, err := json.Marshal(rv)
 				if err != nil {
 					e := w.Return(&rpc.Return{
@@ -0,0 +1,124 @@
+package seal
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/metadata"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/illikainen/go-cryptor/src/blob"
+	"github.com/illikainen/go-utils/src/base64"
+	"github.com/illikainen/go-utils/src/errorx"
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/pkg/errors"
+)
+
+// IsSealed checks whether a file is sealed based on its extension.
+func IsSealed(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".hclseal" || ext == ".seal"
+}
+
+// UnsealedName returns the name of a sealed file without the seal extension,
+// e.g., `db.json' for `db.json.seal' and `db.hcl' for `db.hclseal'.
+func UnsealedName(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".seal":
+		return path[:len(path)-len(".seal")]
+	case ".hclseal":
+		return path[:len(path)-len(".hclseal")] + ".hcl"
+	}
+	return path
+}
+
+// Unseal verifies and decrypts a sealed file with the keyring of a config.
+func Unseal(path string, config *configs.Config) ([]byte, error) {
+	keys, err := blob.ReadKeyring(config.PrivateKey, config.PublicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadFile(path, keys)
+}
+
+// ReadSource reads a file that may be sealed.  Sealed files are unsealed with
+// the keyring of the config, either if they're referenced directly or if a
+// file is missing but its `.seal' companion exists.  The second return value
+// is true if the file was sealed.
+func ReadSource(path string, config *configs.Config) ([]byte, bool, error) {
+	if IsSealed(path) {
+		data, err := Unseal(path, config)
+		return data, true, err
+	}
+
+	data, err := iofs.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, e := os.Stat(path + ".seal"); e == nil {
+			data, err := Unseal(path+".seal", config)
+			return data, true, err
+		}
+	}
+	return data, false, err
+}
+
+// ReadFile verifies and decrypts a sealed file.
+func ReadFile(path string, keys *blob.Keyring) (data []byte, err error) {
+	input, err := os.Open(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	defer errorx.Defer(input.Close, &err)
+
+	decoder, err := base64.NewDecoder(base64.StdEncoding.Strict(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	blobber, err := blob.NewReader(decoder, &blob.Options{
+		Type:      metadata.Name(),
+		Keyring:   keys,
+		Encrypted: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	_, err = io.Copy(buf, blobber)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteFile signs and encrypts data to path.  The blob is written to a
+// temporary file that is renamed in place once it's complete.
+func WriteFile(path string, data []byte, keys *blob.Keyring) error {
+	return utils.WriteFile(path, 0600, func(f *os.File) error {
+		return writeBlob(f, data, keys)
+	})
+}
+
+func writeBlob(output *os.File, data []byte, keys *blob.Keyring) (err error) {
+	encoder := base64.NewEncoder(base64.StdEncoding.Strict(), output, 72)
+	defer errorx.Defer(encoder.Close, &err)
+
+	blobber, err := blob.NewWriter(encoder, &blob.Options{
+		Type:      metadata.Name(),
+		Keyring:   keys,
+		Encrypted: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer errorx.Defer(blobber.Close, &err)
+
+	_, err = blobber.Write(data)
+	return err
+}
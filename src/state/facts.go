@@ -0,0 +1,126 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/illikainen/orch/src/fact"
+	"github.com/illikainen/orch/src/seal"
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/illikainen/go-cryptor/src/blob"
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var hostRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+type CachedFacts struct {
+	Host       string      `json:"host"`
+	Facts      *fact.Facts `json:"facts"`
+	GatheredAt time.Time   `json:"gathered_at"`
+}
+
+// Age returns how long ago the facts were gathered.
+func (c *CachedFacts) Age() time.Duration {
+	return time.Since(c.GatheredAt)
+}
+
+// FactCache stores the most recently gathered facts for every host.  Facts
+// are sealed with the keyring if one is provided.
+type FactCache struct {
+	dir  string
+	keys *blob.Keyring
+}
+
+func NewFactCache(dir string, keys *blob.Keyring) *FactCache {
+	return &FactCache{dir: dir, keys: keys}
+}
+
+func (c *FactCache) Dir() string {
+	return filepath.Join(c.dir, "facts")
+}
+
+func (c *FactCache) path(host string) (string, error) {
+	if !hostRegexp.MatchString(host) || host == "." || host == ".." {
+		return "", errors.Errorf("invalid host name: %s", host)
+	}
+
+	if c.keys != nil {
+		return filepath.Join(c.Dir(), host+".json.seal"), nil
+	}
+	return filepath.Join(c.Dir(), host+".json"), nil
+}
+
+func (c *FactCache) Write(host string, facts *fact.Facts) error {
+	path, err := c.path(host)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(c.Dir(), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&CachedFacts{
+		Host:       host,
+		Facts:      facts,
+		GatheredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.keys != nil {
+		err = seal.WriteFile(path, data, c.keys)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = utils.WriteData(path, data, 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("state: wrote %s", path)
+	return nil
+}
+
+// Read returns the cached facts for a host, or nil if there are none.
+func (c *FactCache) Read(host string) (*CachedFacts, error) {
+	path, err := c.path(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if c.keys != nil {
+		data, err = seal.ReadFile(path, c.keys)
+	} else {
+		data, err = iofs.ReadFile(path)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, path)
+	}
+
+	cached := &CachedFacts{}
+	err = json.Unmarshal(data, cached)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	if cached.Host != host || cached.Facts == nil {
+		return nil, errors.Errorf("%s: invalid fact cache", path)
+	}
+
+	return cached, nil
+}
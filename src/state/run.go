@@ -0,0 +1,66 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/illikainen/orch/src/tasks/outputs"
+)
+
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+const TimeFormat = "2006-01-02 15:04:05"
+
+type Run struct {
+	ID         string          `json:"id"`
+	Blueprint  string          `json:"blueprint"`
+	Hash       string          `json:"hash"`
+	Hosts      []string        `json:"hosts"`
+	Outputs    outputs.Outputs `json:"outputs"`
+	DryRun     bool            `json:"dry_run"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+}
+
+func NewRun(blueprint string, dryRun bool) (*Run, error) {
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &Run{
+		ID:        now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Blueprint: blueprint,
+		DryRun:    dryRun,
+		Status:    StatusRunning,
+		StartedAt: now,
+	}, nil
+}
+
+func (r *Run) Finish(err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.Status = StatusSuccess
+	if err != nil {
+		r.Status = StatusFailure
+		r.Error = err.Error()
+	}
+}
+
+func (r *Run) Changed(host string) int {
+	n := 0
+	for _, out := range r.Outputs {
+		if (host == "" || out.Host == host) && out.IsChanged() {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,110 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/illikainen/orch/src/utils"
+
+	"github.com/illikainen/go-utils/src/iofs"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var idRegexp = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9a-f]{8}$`)
+
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) Dir() string {
+	return filepath.Join(s.dir, "runs")
+}
+
+func (s *Store) Write(run *Run) error {
+	if !idRegexp.MatchString(run.ID) {
+		return errors.Errorf("invalid run id: %s", run.ID)
+	}
+
+	err := os.MkdirAll(s.Dir(), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(run, "", "    ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// The record is written to a temporary file that is renamed in place to
+	// avoid leaving truncated records behind if we're interrupted.
+	path := filepath.Join(s.Dir(), run.ID+".json")
+	err = utils.WriteData(path, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("state: wrote %s", path)
+	return nil
+}
+
+func (s *Store) Read(id string) (*Run, error) {
+	if !idRegexp.MatchString(id) {
+		return nil, errors.Errorf("invalid run id: %s", id)
+	}
+
+	data, err := iofs.ReadFile(filepath.Join(s.Dir(), id+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Errorf("%s: no such run", id)
+		}
+		return nil, err
+	}
+
+	run := &Run{}
+	err = json.Unmarshal(data, run)
+	if err != nil {
+		return nil, errors.Wrap(err, id)
+	}
+
+	return run, nil
+}
+
+// List returns every recorded run, oldest first.
+func (s *Store) List() ([]*Run, error) {
+	entries, err := os.ReadDir(s.Dir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	runs := []*Run{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		run, err := s.Read(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	sort.SliceStable(runs, func(i int, j int) bool {
+		return runs[i].StartedAt.Before(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
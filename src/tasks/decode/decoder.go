@@ -4,12 +4,14 @@ import (
 	"github.com/illikainen/orch/src/configs"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
 )
 
 type Decoder interface {
 	Decode(hcl.Body, *hcl.EvalContext, *configs.Config) error
+	Spec() hcldec.Spec
 	Validate() error
 	Include() bool
 	Value() cty.Value
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 
 	"github.com/illikainen/orch/src/configs"
+	"github.com/illikainen/orch/src/seal"
 	"github.com/illikainen/orch/src/tasks/decode"
 	"github.com/illikainen/orch/src/utils"
 
@@ -12,7 +13,6 @@ import (
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/illikainen/go-utils/src/fn"
-	"github.com/illikainen/go-utils/src/iofs"
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -21,6 +21,38 @@ func init() {
 	fn.Must(decode.Register("file_manage", NewDecoder))
 }
 
+var spec = &hcldec.ObjectSpec{
+	"condition": &hcldec.AttrSpec{
+		Name: "condition",
+		Type: cty.Bool,
+	},
+	"src": &hcldec.AttrSpec{
+		Name: "src",
+		Type: cty.String,
+	},
+	"dst": &hcldec.AttrSpec{
+		Name:     "dst",
+		Type:     cty.String,
+		Required: true,
+	},
+	"content": &hcldec.AttrSpec{
+		Name: "content",
+		Type: cty.String,
+	},
+	"file_mode": &hcldec.AttrSpec{
+		Name: "file_mode",
+		Type: cty.Number,
+	},
+	"dir_mode": &hcldec.AttrSpec{
+		Name: "dir_mode",
+		Type: cty.Number,
+	},
+	"ignore_dir_mode": &hcldec.AttrSpec{
+		Name: "ignore_dir_mode",
+		Type: cty.Bool,
+	},
+}
+
 type Decoder struct {
 	Task
 }
@@ -30,41 +62,7 @@ func NewDecoder() (decode.Decoder, error) {
 }
 
 func (t *Decoder) Decode(body hcl.Body, ctx *hcl.EvalContext, config *configs.Config) error {
-	value, diags := hcldec.Decode(
-		body,
-		&hcldec.ObjectSpec{
-			"condition": &hcldec.AttrSpec{
-				Name: "condition",
-				Type: cty.Bool,
-			},
-			"src": &hcldec.AttrSpec{
-				Name: "src",
-				Type: cty.String,
-			},
-			"dst": &hcldec.AttrSpec{
-				Name:     "dst",
-				Type:     cty.String,
-				Required: true,
-			},
-			"content": &hcldec.AttrSpec{
-				Name: "content",
-				Type: cty.String,
-			},
-			"file_mode": &hcldec.AttrSpec{
-				Name: "file_mode",
-				Type: cty.Number,
-			},
-			"dir_mode": &hcldec.AttrSpec{
-				Name: "dir_mode",
-				Type: cty.Number,
-			},
-			"ignore_dir_mode": &hcldec.AttrSpec{
-				Name: "ignore_dir_mode",
-				Type: cty.Bool,
-			},
-		},
-		ctx,
-	)
+	value, diags := hcldec.Decode(body, spec, ctx)
 	if diags != nil {
 		return diags
 	}
@@ -73,6 +71,7 @@ func (t *Decoder) Decode(body hcl.Body, ctx *hcl.EvalContext, config *configs.Co
 	if err != nil {
 		return err
 	}
+	t.Sensitive = utils.IsSensitive(value)
 
 	if value.GetAttr("condition").IsNull() {
 		t.Condition = true
@@ -86,11 +85,18 @@ func (t *Decoder) Decode(body hcl.Body, ctx *hcl.EvalContext, config *configs.Co
 			return err
 		}
 
-		data, err := iofs.ReadFile(src)
+		data, sealed, err := seal.ReadSource(src, config)
 		if err != nil {
 			return err
 		}
 		t.Content = base64.StdEncoding.EncodeToString(data)
+
+		// The task is marked as sensitive to redact its output if the
+		// source is sealed.
+		if sealed {
+			t.Sensitive = true
+			value = utils.MarkSensitive(value)
+		}
 	}
 
 	if int(t.FileMode) == 0 {
@@ -106,6 +112,10 @@ func (t *Decoder) Decode(body hcl.Body, ctx *hcl.EvalContext, config *configs.Co
 	return nil
 }
 
+func (t *Decoder) Spec() hcldec.Spec {
+	return spec
+}
+
 func (t *Decoder) Validate() error {
 	if t.Src == "" && t.Content == "" {
 		return errors.Errorf("Missing required argument; Either \"src\" or \"content\" is required.")
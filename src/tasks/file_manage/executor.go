@@ -3,10 +3,12 @@ package file_manage // revive:disable-line:var-naming
 
 import (
 	"encoding/base64"
+	"fmt"
 	"path/filepath"
 
 	"github.com/illikainen/orch/src/rpc/worker"
 	"github.com/illikainen/orch/src/tasks/outputs"
+	"github.com/illikainen/orch/src/utils"
 
 	"github.com/illikainen/go-utils/src/fn"
 )
@@ -47,6 +49,10 @@ func (e *Executor) Execute() (any, error) {
 		return nil, err
 	}
 
+	if e.Sensitive && fileChanges != nil {
+		fileChanges = []string{fmt.Sprintf("%s: %s", e.Dst, utils.Redacted)}
+	}
+
 	permFileChanges, err := Chmod(e.Dst, e.FileMode, e.Config.DryRun)
 	if err != nil {
 		return nil, err
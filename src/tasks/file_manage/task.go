@@ -17,6 +17,7 @@ type Task struct {
 	FileMode      os.FileMode     `json:"file_mode"`
 	DirMode       os.FileMode     `json:"dir_mode"`
 	IgnoreDirMode bool            `json:"ignore_dir_mode"`
+	Sensitive     bool            `json:"sensitive"`
 	Config        *configs.Config `json:"config"`
 	value         cty.Value
 }
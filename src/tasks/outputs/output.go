@@ -10,25 +10,46 @@ import (
 )
 
 type Output struct {
-	Type    string              `json:"type"`
-	Host    string              `json:"host"`
-	Role    string              `json:"role"`
-	Name    string              `json:"name"`
-	Changed bool                `json:"changed" cty:"changed"`
-	Diff    map[string][]string `json:"diff"    cty:"diff"`
-	Error   string              `json:"error"`
+	Type      string              `json:"type"`
+	Host      string              `json:"host"`
+	Role      string              `json:"role"`
+	Name      string              `json:"name"`
+	Changed   bool                `json:"changed" cty:"changed"`
+	Skipped   bool                `json:"skipped" cty:"skipped"`
+	Diff      map[string][]string `json:"diff"      cty:"diff"`
+	Sensitive bool                `json:"sensitive"`
+	Error     string              `json:"error"`
 }
 
 func (o *Output) IsChanged() bool {
 	return o.Changed
 }
 
+func (o *Output) Status() string {
+	switch {
+	case o.Skipped:
+		return "skipped"
+	case o.Changed:
+		return "changed"
+	}
+	return "up-to-date"
+}
+
 func (o *Output) Differences() map[string][]string {
 	return o.Diff
 }
 
+// The diff of a sensitive task is marked as sensitive in case it reveals
+// anything about the sensitive input.
 func (o *Output) Value() (cty.Value, error) {
-	return utils.ToCtyValue(o)
+	value, err := utils.ToCtyValue(o)
+	if err != nil || !o.Sensitive {
+		return value, err
+	}
+
+	attrs := value.AsValueMap()
+	attrs["diff"] = utils.MarkSensitive(attrs["diff"])
+	return cty.ObjectVal(attrs), nil
 }
 
 func (o *Output) UnmarshalJSON(data []byte) error {
@@ -1,8 +1,6 @@
 package outputs
 
 import (
-	"encoding/json"
-
 	"github.com/zclconf/go-cty/cty"
 )
 
@@ -39,27 +37,3 @@ func (o *Outputs) Variables() (map[string]cty.Value, error) {
 
 	return map[string]cty.Value{"out": cty.ObjectVal(outputs)}, nil
 }
-
-func (o *Outputs) Clone() (Outputs, error) {
-	// TODO: improve this...
-	data, err := json.Marshal(o)
-	if err != nil {
-		return nil, err
-	}
-
-	var out Outputs
-	err = json.Unmarshal(data, &out)
-	if err != nil {
-		return nil, err
-	}
-
-	return out, nil
-}
-
-func (o *Outputs) Hosts() []string {
-	hosts := []string{}
-	for _, out := range *o {
-		hosts = append(hosts, out.Host)
-	}
-	return hosts
-}
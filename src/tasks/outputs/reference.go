@@ -0,0 +1,59 @@
+package outputs
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// Reference is a reference to the output of another host, e.g.,
+// `out.db1.postgres.create_user'.  Role and Task are empty if the reference
+// stops before them.  The host is `this' for references to the same host.
+type Reference struct {
+	Host  string
+	Role  string
+	Task  string
+	Range hcl.Range
+}
+
+// References returns every reference to an output in an expression.
+func References(expr hcl.Expression) []*Reference {
+	refs := []*Reference{}
+	for _, v := range expr.Variables() {
+		if v.RootName() != "out" || len(v) < 2 {
+			continue
+		}
+
+		names := []string{}
+		for _, step := range v[1:] {
+			attr, ok := step.(hcl.TraverseAttr)
+			if !ok || len(names) == 3 {
+				break
+			}
+			names = append(names, attr.Name)
+		}
+
+		if len(names) == 0 {
+			continue
+		}
+		names = append(names, "", "")
+
+		refs = append(refs, &Reference{
+			Host:  names[0],
+			Role:  names[1],
+			Task:  names[2],
+			Range: v.SourceRange(),
+		})
+	}
+	return refs
+}
+
+func (r *Reference) String() string {
+	names := []string{"out", r.Host}
+	for _, name := range []string{r.Role, r.Task} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ".")
+}
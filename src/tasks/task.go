@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/illikainen/orch/src/configs"
 	"github.com/illikainen/orch/src/rpc"
@@ -9,20 +10,25 @@ import (
 	"github.com/illikainen/orch/src/tasks/decode"
 	_ "github.com/illikainen/orch/src/tasks/file_manage" // decoder
 	"github.com/illikainen/orch/src/tasks/outputs"
+	"github.com/illikainen/orch/src/utils"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/zclconf/go-cty/cty"
 )
 
 type Task struct {
-	Type         string          `json:"type"      hcl:"type,label"`
-	Name         string          `json:"name"      hcl:"name,label"`
-	Body         hcl.Body        `json:"-"         hcl:"body,remain"`
-	Host         string          `json:"host"`
-	Role         string          `json:"role"`
-	Decoder      json.RawMessage `json:"decoder"`
-	Dependencies []string        `json:"-"`
+	Type         string               `json:"type"      hcl:"type,label"`
+	Name         string               `json:"name"      hcl:"name,label"`
+	Tags         []string             `json:"tags"      hcl:"tags,optional"`
+	Body         hcl.Body             `json:"-"         hcl:"body,remain"`
+	Host         string               `json:"host"`
+	Role         string               `json:"role"`
+	Decoder      json.RawMessage      `json:"decoder"`
+	Dependencies []string             `json:"-"`
+	References   []*outputs.Reference `json:"-"`
 	decoder      decode.Decoder
+	config       *configs.Config
 }
 
 func (t *Task) PartialDecode() error {
@@ -32,13 +38,10 @@ func (t *Task) PartialDecode() error {
 	}
 
 	for _, attr := range attrs {
-		for _, v := range attr.Expr.Variables() {
-			if len(v) >= 2 {
-				if root, ok := v[0].(hcl.TraverseRoot); ok && root.Name == "out" {
-					if host, ok := v[1].(hcl.TraverseAttr); ok && host.Name != "this" {
-						t.Dependencies = append(t.Dependencies, host.Name)
-					}
-				}
+		for _, ref := range outputs.References(attr.Expr) {
+			t.References = append(t.References, ref)
+			if ref.Host != "this" {
+				t.Dependencies = append(t.Dependencies, ref.Host)
 			}
 		}
 	}
@@ -46,9 +49,9 @@ func (t *Task) PartialDecode() error {
 	return nil
 }
 
-func (t *Task) Decode(role string, host string, ctxfn func() (*hcl.EvalContext, error),
+func (t *Task) Decode(role string, host string, ctxfn func(hcl.Body) (*hcl.EvalContext, error),
 	config *configs.Config) error {
-	ctx, err := ctxfn()
+	ctx, err := ctxfn(t.Body)
 	if err != nil {
 		return err
 	}
@@ -64,12 +67,40 @@ func (t *Task) Decode(role string, host string, ctxfn func() (*hcl.EvalContext,
 	}
 
 	t.decoder = decoder
+	t.config = config
 	t.Role = role
 	t.Host = host
 
 	return decoder.Validate()
 }
 
+// Check type-checks the attributes of the task against the spec of its
+// decoder without decoding them.  Unlike Decode(), it accepts unknown values,
+// so it can be used before the facts and outputs of a host are known.
+func (t *Task) Check(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
+	decoder, err := decode.Lookup(t.Type)
+	if err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid task type",
+			Detail:   fmt.Sprintf("The task \"%s\" has an invalid type: %s.", t.Name, err),
+			Subject:  t.Body.MissingItemRange().Ptr(),
+		}}
+	}
+
+	ctx, err := ctxfn(t.Body)
+	if err != nil {
+		return err
+	}
+
+	_, diags := hcldec.Decode(t.Body, decoder.Spec(), ctx)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	return nil
+}
+
 func (t *Task) Validate() error {
 	return nil
 }
@@ -79,9 +110,25 @@ func (t *Task) Include() bool {
 }
 
 func (t *Task) Apply(ctrl *controller.Controller) (*outputs.Output, error) {
+	var audit *rpc.Audit
+	if t.config != nil && t.config.AuditLog != "" && !t.config.DryRun {
+		identity, err := rpc.Identity()
+		if err != nil {
+			return nil, err
+		}
+
+		audit = &rpc.Audit{
+			Log:        t.config.AuditLog,
+			Controller: identity,
+			Role:       t.Role,
+			Name:       t.Name,
+		}
+	}
+
 	rv, err := ctrl.Call(&rpc.FunctionCall{
 		Function: t.Type,
 		Params:   t.decoder,
+		Audit:    audit,
 	})
 	if err != nil {
 		return nil, err
@@ -96,6 +143,7 @@ func (t *Task) Apply(ctrl *controller.Controller) (*outputs.Output, error) {
 	output.Name = t.Name
 	output.Host = t.Host
 	output.Role = t.Role
+	output.Sensitive = utils.IsSensitive(t.decoder.Value())
 
 	return &output, nil
 }
@@ -15,7 +15,7 @@ func (t *Tasks) PartialDecode() error {
 	return nil
 }
 
-func (t *Tasks) Decode(_ func() (*hcl.EvalContext, error)) error {
+func (t *Tasks) Decode(_ func(hcl.Body) (*hcl.EvalContext, error)) error {
 	return nil
 }
 
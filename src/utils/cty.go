@@ -2,11 +2,14 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/pkg/errors"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/gocty"
@@ -23,7 +26,19 @@ func ToCtyValue(value any) (cty.Value, error) {
 }
 
 // Ugly workaround because gocty.FromCtyValue() doesn't support optional values.
+// Marks are removed, but sensitive values are registered with the log hook.
 func FromCtyValue(value cty.Value, out any) error {
+	value, paths := value.UnmarkDeepWithPaths()
+	for _, pvm := range paths {
+		if _, ok := pvm.Marks[Sensitive]; ok {
+			v, err := pvm.Path.Apply(value)
+			if err != nil {
+				return err
+			}
+			RegisterSecrets(v)
+		}
+	}
+
 	data, err := ctyjson.Marshal(value, value.Type())
 	if err != nil {
 		return err
@@ -96,3 +111,30 @@ func JoinCtyPath[T *hclsyntax.Body | string](base T, sub string) (string, error)
 
 	return path, nil
 }
+
+// CtyPaths flattens a value into a sorted list of `path = value' lines.
+func CtyPaths(name string, value cty.Value) []string {
+	lines := []string{}
+
+	ty := value.Type()
+	switch {
+	case value.IsNull() || !value.IsKnown() || ty.IsPrimitiveType() || value.LengthInt() == 0:
+		tokens := hclwrite.TokensForValue(value)
+		lines = append(lines, fmt.Sprintf("%s = %s", name, tokens.Bytes()))
+	case ty.IsObjectType() || ty.IsMapType():
+		for key, elt := range value.AsValueMap() {
+			path := fmt.Sprintf("%s[%q]", name, key)
+			if hclsyntax.ValidIdentifier(key) {
+				path = name + "." + key
+			}
+			lines = append(lines, CtyPaths(path, elt)...)
+		}
+	default:
+		for i, elt := range value.AsValueSlice() {
+			lines = append(lines, CtyPaths(fmt.Sprintf("%s[%d]", name, i), elt)...)
+		}
+	}
+
+	sort.Strings(lines)
+	return lines
+}
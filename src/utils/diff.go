@@ -3,6 +3,7 @@ package utils
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/illikainen/go-utils/src/stringx"
 	"github.com/pkg/errors"
@@ -35,3 +36,42 @@ func FormatDiff(diffs []diffmatchpatch.Diff) (string, error) {
 
 	return buf.String(), nil
 }
+
+// LineDiff compares two texts line by line.  Every unique line is replaced by
+// a rune in a private use plane before diffing, since DiffLinesToChars() is
+// broken for texts with more than a few lines.
+func LineDiff(text1 string, text2 string) []diffmatchpatch.Diff {
+	const base = 0xf0000
+
+	lines := []string{}
+	index := map[string]rune{}
+	encode := func(text string) string {
+		runes := []rune{}
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				continue
+			}
+
+			r, ok := index[line]
+			if !ok {
+				r = rune(base + len(lines))
+				index[line] = r
+				lines = append(lines, line)
+			}
+			runes = append(runes, r)
+		}
+		return string(runes)
+	}
+
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMain(encode(text1), encode(text2), false)
+	for i, diff := range diffs {
+		text := strings.Builder{}
+		for _, r := range diff.Text {
+			text.WriteString(lines[r-base])
+		}
+		diffs[i].Text = text.String()
+	}
+
+	return diffs
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/illikainen/go-utils/src/errorx"
+)
+
+// WriteFile replaces a file with what write() writes to it.  The data is
+// written to a temporary file in the same directory that is renamed in place
+// once it's complete, so an interrupted write never leaves a truncated file
+// behind.  The temporary file is removed if anything fails.
+func WriteFile(path string, perm fs.FileMode, write func(*os.File) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	err = write(tmp)
+	if err != nil {
+		return errorx.Join(err, tmp.Close())
+	}
+
+	err = tmp.Chmod(perm)
+	if err != nil {
+		return errorx.Join(err, tmp.Close())
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteData replaces a file with data, see WriteFile().
+func WriteData(path string, data []byte, perm fs.FileMode) error {
+	return WriteFile(path, perm, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Sensitive is the cty mark for values that must not be revealed in logs,
+// diffs or reports.
+const Sensitive = "sensitive"
+
+// Redacted replaces sensitive values.
+const Redacted = "(sensitive)"
+
+// Secrets shorter than this aren't redacted from free-form log messages
+// because that would mangle unrelated output.
+const minSecretLength = 4
+
+var secrets = struct {
+	sync.RWMutex
+	values map[string]bool
+}{values: map[string]bool{}}
+
+func MarkSensitive(value cty.Value) cty.Value {
+	return value.Mark(Sensitive)
+}
+
+// IsSensitive checks whether a value or any value nested in it is marked as
+// sensitive.
+func IsSensitive(value cty.Value) bool {
+	_, marks := value.UnmarkDeep()
+	_, ok := marks[Sensitive]
+	return ok
+}
+
+// Redact replaces every sensitive value with Redacted.  Collections are
+// converted to tuples and objects since a redacted element may no longer have
+// the type of its siblings, so the result is only suitable for display.
+func Redact(value cty.Value) cty.Value {
+	if value.HasMark(Sensitive) {
+		return cty.StringVal(Redacted)
+	}
+
+	value, marks := value.Unmark()
+	if value.IsNull() || !value.IsKnown() {
+		return value.WithMarks(marks)
+	}
+
+	ty := value.Type()
+	switch {
+	case ty.IsObjectType() || ty.IsMapType():
+		attrs := map[string]cty.Value{}
+		for it := value.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+			attrs[k.AsString()] = Redact(v)
+		}
+		return cty.ObjectVal(attrs).WithMarks(marks)
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		elts := []cty.Value{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			elts = append(elts, Redact(v))
+		}
+		return cty.TupleVal(elts).WithMarks(marks)
+	}
+
+	return value.WithMarks(marks)
+}
+
+// RedactContext returns a copy of a context, including its parents, where
+// every sensitive value is redacted.  Diagnostics show the values that an
+// expression refers to, so they must be given a redacted context.
+func RedactContext(ctx *hcl.EvalContext) *hcl.EvalContext {
+	if ctx == nil {
+		return nil
+	}
+
+	redacted := &hcl.EvalContext{}
+	if parent := ctx.Parent(); parent != nil {
+		redacted = RedactContext(parent).NewChild()
+	}
+
+	if ctx.Variables != nil {
+		redacted.Variables = map[string]cty.Value{}
+		for name, value := range ctx.Variables {
+			redacted.Variables[name] = Redact(value)
+		}
+	}
+	redacted.Functions = ctx.Functions
+	return redacted
+}
+
+// RegisterSecrets records every primitive value in a sensitive value so that
+// the log hook can redact them.
+func RegisterSecrets(value cty.Value) {
+	value, _ = value.UnmarkDeep()
+
+	_ = cty.Walk(value, func(_ cty.Path, v cty.Value) (bool, error) {
+		if v.IsNull() || !v.IsKnown() {
+			return false, nil
+		}
+
+		switch v.Type() {
+		case cty.String:
+			RegisterSecret(v.AsString())
+		case cty.Number:
+			RegisterSecret(v.AsBigFloat().Text('f', -1))
+		}
+		return true, nil
+	})
+}
+
+func RegisterSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+	secrets.values[secret] = true
+}
+
+// RedactString replaces every registered secret in a string.
+func RedactString(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+
+	for secret := range secrets.values {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// RedactHook is a logrus hook that redacts registered secrets from log
+// messages and string fields.
+type RedactHook struct{}
+
+func (h *RedactHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *RedactHook) Fire(entry *log.Entry) error {
+	entry.Message = RedactString(entry.Message)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = RedactString(s)
+		}
+	}
+	return nil
+}
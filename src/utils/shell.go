@@ -0,0 +1,10 @@
+package utils
+
+import (
+	"strings"
+)
+
+// ShellQuote quotes a string as a single word for POSIX shells.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
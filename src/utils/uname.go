@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var unameArchs = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"armv7":   "arm",
+	"armv8l":  "arm",
+	"i386":    "386",
+	"i486":    "386",
+	"i586":    "386",
+	"i686":    "386",
+	"riscv64": "riscv64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+}
+
+// ParseUname maps the output of `uname -s -m` to GOOS and GOARCH.
+func ParseUname(output string) (goos string, goarch string, err error) {
+	elts := strings.Fields(output)
+	if len(elts) != 2 {
+		return "", "", errors.Errorf("invalid uname output: %s", output)
+	}
+
+	goarch, ok := unameArchs[strings.ToLower(elts[1])]
+	if !ok {
+		return "", "", errors.Errorf("unsupported architecture: %s", elts[1])
+	}
+
+	return strings.ToLower(elts[0]), goarch, nil
+}
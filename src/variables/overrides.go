@@ -0,0 +1,98 @@
+package variables
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// ParseOverride parses a `name=expr' argument.  The expression is evaluated
+// without any variables or functions, so strings must be quoted.
+func ParseOverride(arg string) (string, cty.Value, error) {
+	name, src, ok := strings.Cut(arg, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !hclsyntax.ValidIdentifier(name) {
+		return "", cty.NilVal, errors.Errorf("invalid variable %q; expected name=value", arg)
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(src), "<var "+name+">", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", cty.NilVal, diags
+	}
+
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return "", cty.NilVal, errors.Errorf("%s (strings must be quoted, e.g., --var '%s=\"%s\"')",
+			diags.Error(), name, src)
+	}
+
+	return name, value, nil
+}
+
+// ParseOverrideFile parses a JSON object or an HCL file with one attribute
+// per variable.  Sealed files must be unsealed by the caller.
+func ParseOverrideFile(path string, data []byte) (map[string]cty.Value, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		typ, err := ctyjson.ImpliedType(data)
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+
+		if !typ.IsObjectType() {
+			return nil, errors.Errorf("%s: expected a JSON object", path)
+		}
+
+		value, err := ctyjson.Unmarshal(data, typ)
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+
+		return value.AsValueMap(), nil
+	}
+
+	file, diags := hclsyntax.ParseConfig(data, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	values := map[string]cty.Value{}
+	for name, attr := range attrs {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// Override replaces the value of declared variables.  Overriding a variable
+// that isn't declared is an error to catch typos.
+func (v *Variables) Override(values map[string]cty.Value) error {
+	for name, value := range values {
+		found := false
+		for _, elt := range *v {
+			if elt.Name == name {
+				elt.override = value
+				found = true
+			}
+		}
+
+		if !found {
+			return errors.Errorf("cannot override undeclared variable \"%s\"", name)
+		}
+	}
+
+	return nil
+}
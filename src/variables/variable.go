@@ -1,50 +1,268 @@
 package variables
 
 import (
+	"fmt"
+
+	"github.com/illikainen/orch/src/tasks/outputs"
+	"github.com/illikainen/orch/src/utils"
+
 	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
 )
 
+var schema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "type"},
+		{Name: "description"},
+		{Name: "default"},
+		{Name: "value"},
+		{Name: "sensitive"},
+		{Name: "nullable"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "validation"},
+	},
+}
+
+var validationSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message", Required: true},
+	},
+}
+
 type Variable struct {
 	Name         string   `hcl:"name,label"`
 	Body         hcl.Body `hcl:"body,remain"`
+	Type         cty.Type
+	Description  string
+	Sensitive    bool
+	Nullable     bool
 	Dependencies []string
+	References   []*outputs.Reference
 	value        cty.Value
+	override     cty.Value
 }
 
+// PartialDecode collects the `out.*' references of the variable so that it
+// can be evaluated after the outputs that it refers to.
 func (v *Variable) PartialDecode() error {
+	content, diags := v.Body.Content(schema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, attr := range content.Attributes {
+		for _, ref := range outputs.References(attr.Expr) {
+			v.References = append(v.References, ref)
+			if ref.Host != "this" {
+				v.Dependencies = append(v.Dependencies, ref.Host)
+			}
+		}
+	}
+
 	return nil
 }
 
-func (v *Variable) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
-	ctx, err := ctxfn()
+// Decode evaluates the variable.  The value is, in order of precedence, an
+// override from the command line, the `value' attribute or the `default'
+// attribute.  Untyped variables without any of them are null unless
+// `nullable' is false.  The value is converted to `type' (if any) and checked
+// against every `validation' block.
+func (v *Variable) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
+	ctx, err := ctxfn(v.Body)
 	if err != nil {
 		return err
 	}
 
-	value, diags := hcldec.Decode(
-		v.Body,
-		&hcldec.ObjectSpec{
-			"value": &hcldec.AttrSpec{
-				Name: "value",
-				Type: cty.DynamicPseudoType,
-			},
-		},
-		ctx,
-	)
-	if diags != nil {
+	content, diags := v.Body.Content(schema)
+	if diags.HasErrors() {
 		return diags
 	}
 
+	v.Type = cty.DynamicPseudoType
+	if attr, ok := content.Attributes["type"]; ok {
+		v.Type, diags = typeexpr.TypeConstraint(attr.Expr)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	if attr, ok := content.Attributes["description"]; ok {
+		diags = gohcl.DecodeExpression(attr.Expr, ctx, &v.Description)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		diags = gohcl.DecodeExpression(attr.Expr, ctx, &v.Sensitive)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	v.Nullable = true
+	if attr, ok := content.Attributes["nullable"]; ok {
+		diags = gohcl.DecodeExpression(attr.Expr, ctx, &v.Nullable)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	value, diags := v.evaluate(content, ctx)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, block := range content.Blocks {
+		diags = v.validate(block, ctx, value)
+		if diags.HasErrors() {
+			return diags
+		}
+	}
+
+	if v.Sensitive {
+		value = utils.MarkSensitive(value)
+	}
+
 	v.value = value
 	return nil
 }
 
-func (v *Variable) Value() cty.Value {
-	if v.value != cty.NilVal {
-		return v.value.GetAttr("value")
+func (v *Variable) evaluate(content *hcl.BodyContent, ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	var value cty.Value
+	var rng *hcl.Range
+
+	if v.override != cty.NilVal {
+		value = v.override
+	} else if attr, ok := content.Attributes["value"]; ok {
+		var diags hcl.Diagnostics
+		value, diags = attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+		rng = attr.Expr.Range().Ptr()
+	} else if attr, ok := content.Attributes["default"]; ok {
+		var diags hcl.Diagnostics
+		value, diags = attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return cty.NilVal, diags
+		}
+		rng = attr.Expr.Range().Ptr()
+	} else if _, typed := content.Attributes["type"]; v.Nullable && !typed {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	} else {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing value for variable",
+			Detail: fmt.Sprintf("The variable \"%s\" is typed or not nullable, and has neither a value "+
+				"nor a default.", v.Name),
+			Subject: bodyRange(v.Body),
+		}}
+	}
+
+	converted, err := convert.Convert(value, v.Type)
+	if err != nil {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail: fmt.Sprintf("The value of \"%s\" is not a valid %s: %s.",
+				v.Name, typeexpr.TypeString(v.Type), err),
+			Subject: fallbackRange(rng, v.Body),
+		}}
+	}
+
+	if converted.IsNull() && !v.Nullable {
+		return cty.NilVal, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail:   fmt.Sprintf("The variable \"%s\" is not nullable.", v.Name),
+			Subject:  fallbackRange(rng, v.Body),
+		}}
 	}
+
+	return converted, nil
+}
+
+func (v *Variable) validate(block *hcl.Block, ctx *hcl.EvalContext, value cty.Value) hcl.Diagnostics {
+	content, diags := block.Body.Content(validationSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// The condition is evaluated with the value of this variable since it
+	// hasn't been added to the context yet.
+	vars := map[string]cty.Value{}
+	if parent, ok := ctx.Variables["var"]; ok && parent.CanIterateElements() {
+		for it := parent.ElementIterator(); it.Next(); {
+			k, elt := it.Element()
+			vars[k.AsString()] = elt
+		}
+	}
+	vars[v.Name] = value
+
+	child := ctx.NewChild()
+	child.Variables = map[string]cty.Value{"var": cty.ObjectVal(vars)}
+
+	condition := content.Attributes["condition"]
+	result, diags := condition.Expr.Value(child)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Conditions that depend on unknown values, such as the placeholder
+	// facts used by validation, can't be checked yet.  Conditions on
+	// sensitive values are themselves sensitive, but the result is only
+	// used to decide whether the value is valid.
+	result, err := convert.Convert(result, cty.Bool)
+	if err == nil {
+		result, _ = result.UnmarkDeep()
+	}
+	if err == nil && !result.IsKnown() {
+		return nil
+	}
+
+	// Diagnostics show the values that the condition refers to, and the
+	// error message may include them as well, so both are redacted.
+	redacted := utils.RedactContext(child)
+
+	if err != nil || result.IsNull() {
+		return hcl.Diagnostics{{
+			Severity:    hcl.DiagError,
+			Summary:     "Invalid validation condition",
+			Detail:      "The condition must evaluate to true or false.",
+			Subject:     condition.Expr.Range().Ptr(),
+			Expression:  condition.Expr,
+			EvalContext: redacted,
+		}}
+	}
+
+	if result.True() {
+		return nil
+	}
+
+	var message string
+	diags = gohcl.DecodeExpression(content.Attributes["error_message"].Expr, redacted, &message)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	return hcl.Diagnostics{{
+		Severity:    hcl.DiagError,
+		Summary:     "Invalid value for variable",
+		Detail:      message,
+		Subject:     condition.Expr.Range().Ptr(),
+		Expression:  condition.Expr,
+		EvalContext: redacted,
+	}}
+}
+
+func (v *Variable) Value() cty.Value {
 	return v.value
 }
 
@@ -55,3 +273,19 @@ func (v *Variable) Unique() string {
 func (v *Variable) Validate() error {
 	return nil
 }
+
+func bodyRange(body hcl.Body) *hcl.Range {
+	if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+		return syntaxBody.SrcRange.Ptr()
+	}
+	return nil
+}
+
+// Overrides from the command line don't have a source range, so the error is
+// reported at the variable block instead.
+func fallbackRange(rng *hcl.Range, body hcl.Body) *hcl.Range {
+	if rng != nil {
+		return rng
+	}
+	return bodyRange(body)
+}
@@ -1,6 +1,8 @@
 package variables
 
 import (
+	"github.com/illikainen/orch/src/tasks/outputs"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/illikainen/go-utils/src/seq"
 	"github.com/pkg/errors"
@@ -18,7 +20,7 @@ func (v *Variables) PartialDecode() error {
 	return nil
 }
 
-func (v *Variables) Decode(ctxfn func() (*hcl.EvalContext, error)) error {
+func (v *Variables) Decode(ctxfn func(hcl.Body) (*hcl.EvalContext, error)) error {
 	for _, elt := range *v {
 		if err := elt.Decode(ctxfn); err != nil {
 			return err
@@ -35,6 +37,14 @@ func (v *Variables) Dependencies() []string {
 	return deps
 }
 
+func (v *Variables) References() []*outputs.Reference {
+	refs := []*outputs.Reference{}
+	for _, elt := range *v {
+		refs = append(refs, elt.References...)
+	}
+	return refs
+}
+
 func (v *Variables) Variables() map[string]cty.Value {
 	vars := map[string]cty.Value{}
 	for _, variable := range *v {